@@ -0,0 +1,171 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Array returns a sql.Scanner that scans a spanner ARRAY column into dest, which must
+// be a pointer to a slice. It works with rows returned in either ResultMode.  Elements are
+// converted the same way as ResultModeStandard values, so dest can be a slice of plain types,
+// pointers, or sql.Scanners like sql.NullString. A NULL array sets dest to nil.
+// Example:
+//   var tags []string
+//   err := row.Scan(sqlspanner.Array(&tags))
+func Array(dest interface{}) sql.Scanner {
+	return &arrayScanner{dest: dest}
+}
+
+// StringArray returns a sql.Scanner for an ARRAY<STRING> column
+func StringArray(dest *[]string) sql.Scanner {
+	return Array(dest)
+}
+
+// Int64Array returns a sql.Scanner for an ARRAY<INT64> column
+func Int64Array(dest *[]int64) sql.Scanner {
+	return Array(dest)
+}
+
+// Float64Array returns a sql.Scanner for an ARRAY<FLOAT64> column
+func Float64Array(dest *[]float64) sql.Scanner {
+	return Array(dest)
+}
+
+// BoolArray returns a sql.Scanner for an ARRAY<BOOL> column
+func BoolArray(dest *[]bool) sql.Scanner {
+	return Array(dest)
+}
+
+// BytesArray returns a sql.Scanner for an ARRAY<BYTES> column
+func BytesArray(dest *[][]byte) sql.Scanner {
+	return Array(dest)
+}
+
+// TimeArray returns a sql.Scanner for an ARRAY<TIMESTAMP> or ARRAY<DATE> column
+func TimeArray(dest *[]time.Time) sql.Scanner {
+	return Array(dest)
+}
+
+type arrayScanner struct {
+	dest interface{}
+}
+
+func (a *arrayScanner) Scan(src interface{}) error {
+	dv := reflect.ValueOf(a.dest)
+	if dv.Kind() != reflect.Ptr || dv.IsNil() || dv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("array destination must be a non nil pointer to a slice, got %T", a.dest)
+	}
+	slice := dv.Elem()
+	if src == nil {
+		slice.Set(reflect.Zero(slice.Type()))
+		return nil
+	}
+	if _, ok := src.([]byte); ok {
+		return fmt.Errorf("cannot scan a BYTES value into an array")
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Kind() != reflect.Slice {
+		return fmt.Errorf("cannot scan %T into an array", src)
+	}
+	if sv.IsNil() {
+		slice.Set(reflect.Zero(slice.Type()))
+		return nil
+	}
+	out := reflect.MakeSlice(slice.Type(), sv.Len(), sv.Len())
+	for i := 0; i < sv.Len(); i++ {
+		elem, err := StandardValue(sv.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		if err := assignArrayElem(out.Index(i), elem); err != nil {
+			return fmt.Errorf("array element %d: %v", i, err)
+		}
+	}
+	slice.Set(out)
+	return nil
+}
+
+func assignArrayElem(dest reflect.Value, src driver.Value) error {
+	if sc, ok := dest.Addr().Interface().(sql.Scanner); ok {
+		return sc.Scan(src)
+	}
+	if src == nil {
+		switch dest.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Slice:
+			dest.Set(reflect.Zero(dest.Type()))
+			return nil
+		}
+		return fmt.Errorf("cannot scan NULL into %s", dest.Type())
+	}
+	if dest.Kind() == reflect.Ptr {
+		ptr := reflect.New(dest.Type().Elem())
+		if err := assignArrayElem(ptr.Elem(), src); err != nil {
+			return err
+		}
+		dest.Set(ptr)
+		return nil
+	}
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dest.Type()) {
+		dest.Set(sv)
+		return nil
+	}
+	if sameKindClass(sv.Kind(), dest.Kind()) && sv.Type().ConvertibleTo(dest.Type()) {
+		dest.Set(sv.Convert(dest.Type()))
+		return nil
+	}
+	return fmt.Errorf("cannot scan %T into %s", src, dest.Type())
+}
+
+// conversions are only allowed between ints, floats, or strings,
+// so an int64 is never silently turned into a string
+func sameKindClass(a, b reflect.Kind) bool {
+	class := func(k reflect.Kind) int {
+		switch k {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return 1
+		case reflect.Float32, reflect.Float64:
+			return 2
+		case reflect.String:
+			return 3
+		case reflect.Slice:
+			return 4
+		}
+		return 0
+	}
+	return class(a) != 0 && class(a) == class(b)
+}
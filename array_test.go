@@ -0,0 +1,97 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner_test
+
+import (
+	"database/sql"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Array", func() {
+	Describe("scanning spanner result mode arrays", func() {
+		It("scans into a slice of plain values", func() {
+			var dest []string
+			err := sqlspanner.StringArray(&dest).Scan([]spanner.NullString{
+				spanner.NullString{StringVal: "a", Valid: true},
+				spanner.NullString{StringVal: "b", Valid: true},
+			})
+			Expect(err).To(BeNil())
+			Expect(dest).To(Equal([]string{"a", "b"}))
+		})
+
+		It("refuses to scan a NULL element into a plain value", func() {
+			var dest []int64
+			err := sqlspanner.Int64Array(&dest).Scan([]spanner.NullInt64{spanner.NullInt64{}})
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("scans NULL elements into sql.Scanners and pointers", func() {
+			src := []spanner.NullString{
+				spanner.NullString{StringVal: "a", Valid: true},
+				spanner.NullString{},
+			}
+			var nulls []sql.NullString
+			Expect(sqlspanner.Array(&nulls).Scan(src)).To(BeNil())
+			Expect(nulls).To(Equal([]sql.NullString{
+				sql.NullString{String: "a", Valid: true},
+				sql.NullString{},
+			}))
+
+			var ptrs []*string
+			Expect(sqlspanner.Array(&ptrs).Scan(src)).To(BeNil())
+			Expect(ptrs).To(HaveLen(2))
+			Expect(*ptrs[0]).To(Equal("a"))
+			Expect(ptrs[1]).To(BeNil())
+		})
+	})
+
+	Describe("scanning standard result mode arrays", func() {
+		It("scans into a slice of plain values", func() {
+			var dest []float64
+			err := sqlspanner.Float64Array(&dest).Scan([]interface{}{float64(1.5), float64(2)})
+			Expect(err).To(BeNil())
+			Expect(dest).To(Equal([]float64{1.5, 2}))
+		})
+
+		It("sets the slice to nil for a NULL array", func() {
+			dest := []bool{true}
+			err := sqlspanner.BoolArray(&dest).Scan(nil)
+			Expect(err).To(BeNil())
+			Expect(dest).To(BeNil())
+		})
+	})
+})
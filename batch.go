@@ -0,0 +1,201 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+
+	"cloud.google.com/go/spanner"
+)
+
+type batchCommand int
+
+const (
+	batchNone batchCommand = iota
+	startBatchDDL
+	startBatchDML
+	runBatch
+	abortBatch
+)
+
+var batchCommands = []struct {
+	cmd batchCommand
+	re  *regexp.Regexp
+}{
+	{startBatchDDL, regexp.MustCompile(`(?is)^\s*START\s+BATCH\s+DDL\s*;?\s*$`)},
+	{startBatchDML, regexp.MustCompile(`(?is)^\s*START\s+BATCH\s+DML\s*;?\s*$`)},
+	{runBatch, regexp.MustCompile(`(?is)^\s*RUN\s+BATCH\s*;?\s*$`)},
+	{abortBatch, regexp.MustCompile(`(?is)^\s*ABORT\s+BATCH\s*;?\s*$`)},
+}
+
+// batch commands are handled by the driver, and never sent to spanner
+func parseBatchCommand(query string) batchCommand {
+	for _, bc := range batchCommands {
+		if bc.re.MatchString(query) {
+			return bc.cmd
+		}
+	}
+	return batchNone
+}
+
+type batchKind int
+
+const (
+	batchKindDDL batchKind = iota + 1
+	batchKindDML
+)
+
+// statements queued on a connection between a START BATCH and RUN BATCH.
+// DDL batches are sent as one schema change, DML batches with one BatchUpdate
+type batch struct {
+	kind batchKind
+	ddl  []string
+	dml  []spanner.Statement
+}
+
+func (c *conn) StartBatchDDL() error {
+	return c.startBatch(batchKindDDL)
+}
+
+func (c *conn) StartBatchDML() error {
+	return c.startBatch(batchKindDML)
+}
+
+func (c *conn) startBatch(kind batchKind) error {
+	if c.batch != nil {
+		return fmt.Errorf("cannot start a batch while another batch is running")
+	}
+	if c.tx != nil {
+		return fmt.Errorf("cannot start a batch in a transaction")
+	}
+	c.batch = &batch{kind: kind}
+	return nil
+}
+
+func (c *conn) RunBatch(ctx context.Context) ([]int64, error) {
+	if c.batch == nil {
+		return nil, fmt.Errorf("RUN BATCH called without a running batch")
+	}
+	b := c.batch
+	c.batch = nil
+	c.commitTimestamp = nil
+	c.planned = nil
+	switch b.kind {
+	case batchKindDDL:
+		if len(b.ddl) == 0 {
+			return nil, nil
+		}
+		if c.dryRun {
+			for _, ddl := range b.ddl {
+				c.planWrites(&PlannedWrite{Op: "DDL", Statement: &spanner.Statement{SQL: ddl}})
+			}
+			return nil, nil
+		}
+		return nil, c.execDDL(ctx, b.ddl)
+	case batchKindDML:
+		if len(b.dml) == 0 {
+			return []int64{}, nil
+		}
+		if c.dryRun {
+			for i := range b.dml {
+				c.planWrites(&PlannedWrite{Op: "DML", Statement: &b.dml[i]})
+			}
+			// nothing ran, so nothing was changed
+			return make([]int64, len(b.dml)), nil
+		}
+		var counts []int64
+		commitTimestamp, err := c.client.ReadWriteTransaction(ctx, func(ctx context.Context, tx *spanner.ReadWriteTransaction) error {
+			var err error
+			counts, err = tx.BatchUpdate(ctx, b.dml)
+			return err
+		})
+		if err != nil {
+			return nil, spannerError(err)
+		}
+		c.commitTimestamp = &commitTimestamp
+		return counts, nil
+	}
+	return nil, fmt.Errorf("unknown batch kind")
+}
+
+func (c *conn) AbortBatch() error {
+	if c.batch == nil {
+		return fmt.Errorf("ABORT BATCH called without a running batch")
+	}
+	c.batch = nil
+	return nil
+}
+
+// RUN BATCH reports the total number of rows affected by a DML batch. Use
+// SpannerConn.RunBatch to get the count for each statement
+func (c *conn) execBatchCommand(ctx context.Context, cmd batchCommand) (driver.Result, error) {
+	rowsAffected := int64(0)
+	res := &result{rowsAffected: &rowsAffected}
+	switch cmd {
+	case startBatchDDL:
+		return res, c.StartBatchDDL()
+	case startBatchDML:
+		return res, c.StartBatchDML()
+	case runBatch:
+		counts, err := c.RunBatch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, count := range counts {
+			rowsAffected += count
+		}
+		res.commitTimestamp = c.commitTimestamp
+		return res, nil
+	case abortBatch:
+		return res, c.AbortBatch()
+	}
+	return nil, fmt.Errorf("unknown batch command")
+}
+
+// queues the statement with args as DML. The result does not have a
+// rows affected count, the counts are only known once the batch runs
+func (c *conn) queueDML(s *stmt, args []driver.Value) (driver.Result, error) {
+	params, err := s.dmlArgs().GetFilledArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	// the arg map is reused by every exec of the statement
+	copied := make(map[string]interface{}, len(params))
+	for k, v := range params {
+		copied[k] = v
+	}
+	c.batch.dml = append(c.batch.dml, spanner.Statement{SQL: s.dmlQuery, Params: copied})
+	return &result{}, nil
+}
@@ -0,0 +1,182 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner_test
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Batch", func() {
+	Describe("detecting batch commands", func() {
+		It("recognizes START BATCH DDL, START BATCH DML, RUN BATCH, and ABORT BATCH", func() {
+			Expect(sqlspanner.IsBatchCommand("START BATCH DDL")).To(BeTrue())
+			Expect(sqlspanner.IsBatchCommand("start batch dml;")).To(BeTrue())
+			Expect(sqlspanner.IsBatchCommand("run batch;")).To(BeTrue())
+			Expect(sqlspanner.IsBatchCommand(" ABORT  BATCH ")).To(BeTrue())
+			Expect(sqlspanner.IsBatchCommand("START BATCH")).To(BeFalse())
+		})
+	})
+
+	Describe("turning queries into DML", func() {
+		It("replaces ? with named params", func() {
+			query, args := sqlspanner.ToNamedParams("UPDATE t SET a=? WHERE id=?")
+			Expect(query).To(Equal("UPDATE t SET a=@p0 WHERE id=@p1"))
+			filled, err := args.GetFilledArgs([]driver.Value{"x", int64(1)})
+			Expect(err).To(BeNil())
+			Expect(filled).To(Equal(map[string]interface{}{"p0": "x", "p1": int64(1)}))
+		})
+	})
+
+	Describe("running batches", func() {
+		exec := func(c driver.Conn, query string, args ...driver.Value) (driver.Result, error) {
+			st, err := c.Prepare(query)
+			if err != nil {
+				return nil, err
+			}
+			return st.Exec(args)
+		}
+
+		It("queues DML until the batch runs, and plans it on dry run connections", func() {
+			c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{DryRun: true})
+			_, err := exec(c, "START BATCH DML")
+			Expect(err).To(BeNil())
+			st, err := c.Prepare("UPDATE t SET a = ? WHERE id = ?")
+			Expect(err).To(BeNil())
+			res, err := st.Exec([]driver.Value{"x", int64(1)})
+			Expect(err).To(BeNil())
+			// the counts are not known until the batch runs
+			_, err = res.RowsAffected()
+			Expect(err).ToNot(BeNil())
+			_, err = st.Exec([]driver.Value{"y", int64(2)})
+			Expect(err).To(BeNil())
+			_, err = exec(c, "INSERT INTO t (id, a) VALUES (?, ?)", int64(3), "z")
+			Expect(err).To(BeNil())
+			Expect(c.PlannedWrites()).To(BeEmpty())
+
+			counts, err := c.RunBatch(context.Background())
+			Expect(err).To(BeNil())
+			Expect(counts).To(Equal([]int64{0, 0, 0}))
+			Expect(c.PlannedWrites()).To(Equal([]*sqlspanner.PlannedWrite{
+				{Op: "DML", Statement: &spanner.Statement{SQL: "UPDATE t SET a = @p0 WHERE id = @p1", Params: map[string]interface{}{"p0": "x", "p1": int64(1)}}},
+				{Op: "DML", Statement: &spanner.Statement{SQL: "UPDATE t SET a = @p0 WHERE id = @p1", Params: map[string]interface{}{"p0": "y", "p1": int64(2)}}},
+				{Op: "DML", Statement: &spanner.Statement{SQL: "INSERT INTO t (id, a) VALUES (@p0, @p1)", Params: map[string]interface{}{"p0": int64(3), "p1": "z"}}},
+			}))
+			// the batch is over
+			_, err = c.RunBatch(context.Background())
+			Expect(err).To(MatchError("RUN BATCH called without a running batch"))
+		})
+
+		It("reports the rows affected by RUN BATCH statements", func() {
+			c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{DryRun: true})
+			_, err := exec(c, "START BATCH DML")
+			Expect(err).To(BeNil())
+			res, err := exec(c, "RUN BATCH")
+			Expect(err).To(BeNil())
+			Expect(res.RowsAffected()).To(Equal(int64(0)))
+		})
+
+		It("runs empty batches without spanner", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			Expect(c.StartBatchDML()).To(BeNil())
+			Expect(c.RunBatch(context.Background())).To(Equal([]int64{}))
+			Expect(c.StartBatchDDL()).To(BeNil())
+			Expect(c.RunBatch(context.Background())).To(BeNil())
+		})
+
+		It("plans DDL batches on dry run connections", func() {
+			c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{DryRun: true})
+			Expect(c.StartBatchDDL()).To(BeNil())
+			_, err := exec(c, "CREATE TABLE t (id INT64) PRIMARY KEY (id)")
+			Expect(err).To(BeNil())
+			_, err = exec(c, "CREATE INDEX t_by_id ON t (id)")
+			Expect(err).To(BeNil())
+			Expect(c.PlannedWrites()).To(BeEmpty())
+			Expect(c.RunBatch(context.Background())).To(BeNil())
+			Expect(c.PlannedWrites()).To(Equal([]*sqlspanner.PlannedWrite{
+				{Op: "DDL", Statement: &spanner.Statement{SQL: "CREATE TABLE t (id INT64) PRIMARY KEY (id)"}},
+				{Op: "DDL", Statement: &spanner.Statement{SQL: "CREATE INDEX t_by_id ON t (id)"}},
+			}))
+		})
+
+		It("drops the queued statements when the batch is aborted", func() {
+			c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{DryRun: true})
+			Expect(c.StartBatchDDL()).To(BeNil())
+			_, err := exec(c, "CREATE TABLE t (id INT64) PRIMARY KEY (id)")
+			Expect(err).To(BeNil())
+			_, err = exec(c, "ABORT BATCH")
+			Expect(err).To(BeNil())
+			Expect(c.AbortBatch()).To(MatchError("ABORT BATCH called without a running batch"))
+			_, err = c.RunBatch(context.Background())
+			Expect(err).To(MatchError("RUN BATCH called without a running batch"))
+			// a new batch starts empty
+			Expect(c.StartBatchDDL()).To(BeNil())
+			Expect(c.RunBatch(context.Background())).To(BeNil())
+			Expect(c.PlannedWrites()).To(BeEmpty())
+		})
+
+		It("only runs statements of the batch's kind", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			Expect(c.StartBatchDML()).To(BeNil())
+			_, err := exec(c, "SELECT 1")
+			Expect(err).To(MatchError("only INSERT, UPDATE, and DELETE statements can be run in a DML batch"))
+			_, err = exec(c, "CREATE TABLE t (id INT64) PRIMARY KEY (id)")
+			Expect(err).To(MatchError("cannot run DDL statements in a DML batch"))
+			Expect(c.AbortBatch()).To(BeNil())
+
+			Expect(c.StartBatchDDL()).To(BeNil())
+			_, err = exec(c, "SELECT 1")
+			Expect(err).To(MatchError("only DDL statements can be run in a DDL batch"))
+			_, err = exec(c, "DELETE FROM t WHERE id = ?", int64(1))
+			Expect(err).To(MatchError("only DDL statements can be run in a DDL batch"))
+		})
+
+		It("starts one batch at a time, outside of transactions", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			Expect(c.StartBatchDML()).To(BeNil())
+			Expect(c.StartBatchDDL()).To(MatchError("cannot start a batch while another batch is running"))
+			_, err := exec(c, "START BATCH DML")
+			Expect(err).To(MatchError("cannot start a batch while another batch is running"))
+			Expect(c.AbortBatch()).To(BeNil())
+
+			_, err = c.BeginTx(context.Background(), driver.TxOptions{})
+			Expect(err).To(BeNil())
+			Expect(c.StartBatchDML()).To(MatchError("cannot start a batch in a transaction"))
+		})
+	})
+})
@@ -0,0 +1,326 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+)
+
+const (
+	// spanner allows 80000 mutations in a commit, every column of a row counts as
+	// one, and so does every column of each secondary index the row is written to.
+	// The default leaves room for a few indexes
+	DefaultBulkLoadMaxMutations = 20000
+	// spanner allows 100MB in a commit
+	DefaultBulkLoadMaxBytes    = 32 << 20
+	DefaultBulkLoadConcurrency = 4
+	DefaultBulkLoadMaxRetries  = 5
+)
+
+// BulkLoader writes rows to a table in as few commits as possible. Rows are grouped
+// into batches that stay under the MaxMutations and MaxBytes limits of a commit, and
+// batches are committed in parallel. A batch that fails with a transient error is
+// retried, a batch that still fails is reported by Flush without stopping the others.
+// Batches are committed independently, so a load is not atomic.
+//   loader, err := sqlspanner.NewBulkLoader(conn, "users", []string{"id", "name"})
+//   for _, u := range users {
+//   	err = loader.Add(ctx, u.ID, u.Name)
+//   }
+//   err = loader.Flush(ctx)
+// The options can be changed before the first row is added. Add and Flush must not
+// be called concurrently.
+//
+// A commit that fails with DeadlineExceeded may still have been applied, and its
+// batch is retried like the other transient errors, so Op has to be idempotent. It
+// defaults to spanner.InsertOrUpdate, with spanner.Insert a retried batch can fail
+// with AlreadyExists after its rows were written.
+type BulkLoader struct {
+	Table   string
+	Columns []string
+	// builds the mutation that writes a row, spanner.InsertOrUpdate by default.
+	// spanner.Replace is idempotent too
+	Op           func(table string, columns []string, values []interface{}) *spanner.Mutation
+	MaxMutations int
+	MaxBytes     int
+	// the number of batches committed at the same time
+	Concurrency int
+	// how many times a batch is retried after a transient error
+	MaxRetries int
+
+	apply   func(ctx context.Context, muts []*spanner.Mutation) error
+	sem     chan struct{}
+	wg      sync.WaitGroup
+	pending []*spanner.Mutation
+	bytes   int
+	added   int // the number of rows added, the first row of the pending batch is added - len(pending)
+	mu      sync.Mutex
+	failed  []*BatchError
+}
+
+// BatchError is a batch of rows that could not be committed
+type BatchError struct {
+	// the position of the batch's first row, counting every row added to the loader from 0
+	FirstRow int
+	Rows     int
+	Err      error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("rows %d to %d: %v", e.FirstRow, e.FirstRow+e.Rows-1, e.Err)
+}
+
+// BulkLoadError is returned by Flush when some batches failed. Every row not in
+// one of the failed batches was committed
+type BulkLoadError struct {
+	Batches []*BatchError
+}
+
+func (e *BulkLoadError) Error() string {
+	msgs := make([]string, len(e.Batches))
+	for i, b := range e.Batches {
+		msgs[i] = b.Error()
+	}
+	return fmt.Sprintf("%d batches failed to load: %s", len(e.Batches), strings.Join(msgs, "; "))
+}
+
+// NewBulkLoader creates a BulkLoader that commits with the spanner client of c.
+// c has to stay open until the loader is flushed. When c is in dry run mode the
+// batches are only planned, and PlannedWrites returns every row's mutation
+func NewBulkLoader(c *sql.Conn, table string, columns []string) (*BulkLoader, error) {
+	var apply func(ctx context.Context, muts []*spanner.Mutation) error
+	err := c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(*conn)
+		if !ok {
+			return fmt.Errorf("not a spanner connection: %T", driverConn)
+		}
+		if sc.cfg.ReadOnly {
+			return &ReadOnlyError{Statement: "bulk loads"}
+		}
+		if sc.dryRun {
+			sc.planned = nil
+			apply = func(ctx context.Context, muts []*spanner.Mutation) error {
+				writes := make([]*PlannedWrite, len(muts))
+				for i, m := range muts {
+					writes[i] = &PlannedWrite{Op: "MUTATION", Table: table, Mutation: m}
+				}
+				sc.planWrites(writes...)
+				return nil
+			}
+			return nil
+		}
+		client := sc.client
+		apply = func(ctx context.Context, muts []*spanner.Mutation) error {
+			_, err := client.Apply(ctx, muts)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newBulkLoader(table, columns, apply), nil
+}
+
+func newBulkLoader(table string, columns []string, apply func(context.Context, []*spanner.Mutation) error) *BulkLoader {
+	return &BulkLoader{
+		Table:        table,
+		Columns:      columns,
+		Op:           spanner.InsertOrUpdate,
+		MaxMutations: DefaultBulkLoadMaxMutations,
+		MaxBytes:     DefaultBulkLoadMaxBytes,
+		Concurrency:  DefaultBulkLoadConcurrency,
+		MaxRetries:   DefaultBulkLoadMaxRetries,
+		apply:        apply,
+	}
+}
+
+// Add queues a row with a value for each of the loader's columns. When the pending
+// batch is full it is committed in the background, Add only blocks while Concurrency
+// batches are already being committed, and returns ctx's error if ctx is done first.
+// The row is not added then. ctx is used to commit the batch
+func (b *BulkLoader) Add(ctx context.Context, values ...interface{}) error {
+	if len(values) != len(b.Columns) {
+		return fmt.Errorf("expected %d values for columns %v, got %d", len(b.Columns), b.Columns, len(values))
+	}
+	converted := make([]interface{}, len(values))
+	size := 0
+	for i, v := range values {
+		if !IsValue(v) {
+			return &ConversionError{Column: b.Columns[i], Type: fmt.Sprintf("%T", v), Err: fmt.Errorf("value will not fit in spanner %#v", v)}
+		}
+		value, err := toJSONValue(v)
+		if err != nil {
+			return &ConversionError{Column: b.Columns[i], Type: fmt.Sprintf("%T", v), Err: err}
+		}
+		converted[i] = value
+		size += valueSize(value)
+	}
+	perRow := len(b.Columns)
+	if len(b.pending) > 0 && ((len(b.pending)+1)*perRow > b.MaxMutations || b.bytes+size > b.MaxBytes) {
+		if err := b.commitPending(ctx); err != nil {
+			return err
+		}
+	}
+	b.pending = append(b.pending, b.Op(b.Table, b.Columns, converted))
+	b.bytes += size
+	b.added++
+	return nil
+}
+
+// Flush commits the pending rows, and waits for every batch to finish. If some
+// batches failed it returns a *BulkLoadError listing them, and forgets them so the
+// loader can be reused. When ctx is done before the pending rows started committing
+// it returns ctx's error, and the rows stay pending
+func (b *BulkLoader) Flush(ctx context.Context) error {
+	if len(b.pending) > 0 {
+		if err := b.commitPending(ctx); err != nil {
+			b.wg.Wait()
+			return err
+		}
+	}
+	b.wg.Wait()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.failed) == 0 {
+		return nil
+	}
+	err := &BulkLoadError{Batches: b.failed}
+	b.failed = nil
+	return err
+}
+
+// starts committing the pending batch once fewer than Concurrency batches are being
+// committed. The batch stays pending when ctx is done first
+func (b *BulkLoader) commitPending(ctx context.Context) error {
+	if b.sem == nil {
+		concurrency := b.Concurrency
+		if concurrency < 1 {
+			concurrency = 1
+		}
+		b.sem = make(chan struct{}, concurrency)
+	}
+	select {
+	case b.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	muts := b.pending
+	firstRow := b.added - len(muts)
+	b.pending = nil
+	b.bytes = 0
+
+	b.wg.Add(1)
+	go func() {
+		defer func() {
+			<-b.sem
+			b.wg.Done()
+		}()
+		if err := b.commit(ctx, muts); err != nil {
+			b.mu.Lock()
+			b.failed = append(b.failed, &BatchError{FirstRow: firstRow, Rows: len(muts), Err: err})
+			b.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// applies a batch, retrying transient errors with exponential backoff
+func (b *BulkLoader) commit(ctx context.Context, muts []*spanner.Mutation) error {
+	backoff := 100 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		err := spannerError(b.apply(ctx, muts))
+		if err == nil || attempt >= b.MaxRetries || !IsRetryable(err) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// estimates how many bytes a value adds to a commit
+func valueSize(v interface{}) int {
+	switch t := v.(type) {
+	case nil:
+		return 1
+	case string:
+		return len(t)
+	case []byte:
+		return len(t)
+	case spanner.NullString:
+		return len(t.StringVal)
+	case spanner.NullJSON:
+		if raw, ok := t.Value.(json.RawMessage); ok {
+			return len(raw)
+		}
+		return len(t.String())
+	case *big.Rat, big.Rat, spanner.NullNumeric:
+		return 16
+	case time.Time, spanner.NullTime, civil.Date, spanner.NullDate:
+		return 12
+	case []string:
+		size := 0
+		for _, s := range t {
+			size += len(s)
+		}
+		return size
+	case [][]byte:
+		size := 0
+		for _, bs := range t {
+			size += len(bs)
+		}
+		return size
+	case []spanner.NullString:
+		size := 0
+		for _, s := range t {
+			size += len(s.StringVal)
+		}
+		return size
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice {
+		return 8 * rv.Len()
+	}
+	return 8
+}
@@ -0,0 +1,178 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// records the size of every batch the loader commits
+type testApplier struct {
+	mu      sync.Mutex
+	batches []int
+	calls   int
+	errs    []error       // returned by the first calls, in order
+	block   chan struct{} // when set, commits wait until it is closed
+}
+
+func (a *testApplier) apply(ctx context.Context, muts []*spanner.Mutation) error {
+	if a.block != nil {
+		<-a.block
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.calls++
+	if len(a.errs) > 0 {
+		err := a.errs[0]
+		a.errs = a.errs[1:]
+		if err != nil {
+			return err
+		}
+	}
+	a.batches = append(a.batches, len(muts))
+	return nil
+}
+
+var _ = Describe("BulkLoader", func() {
+	var (
+		ctx     context.Context
+		applier *testApplier
+		loader  *sqlspanner.BulkLoader
+	)
+	BeforeEach(func() {
+		ctx = context.Background()
+		applier = &testApplier{}
+		loader = sqlspanner.NewTestBulkLoader("users", []string{"id", "name"}, applier.apply)
+		loader.Concurrency = 1
+	})
+
+	It("commits every row in one batch when they fit", func() {
+		for i := 0; i < 10; i++ {
+			Expect(loader.Add(ctx, int64(i), "name")).To(BeNil())
+		}
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.batches).To(Equal([]int{10}))
+	})
+
+	It("splits rows into batches under the mutation limit", func() {
+		loader.MaxMutations = 4
+		for i := 0; i < 5; i++ {
+			Expect(loader.Add(ctx, int64(i), "name")).To(BeNil())
+		}
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.batches).To(Equal([]int{2, 2, 1}))
+	})
+
+	It("splits rows into batches under the byte limit", func() {
+		loader.MaxBytes = 250
+		for i := 0; i < 4; i++ {
+			Expect(loader.Add(ctx, int64(i), strings.Repeat("a", 100))).To(BeNil())
+		}
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.batches).To(Equal([]int{2, 2}))
+	})
+
+	It("commits a row bigger than the limits on its own", func() {
+		loader.MaxBytes = 10
+		Expect(loader.Add(ctx, int64(1), strings.Repeat("a", 100))).To(BeNil())
+		Expect(loader.Add(ctx, int64(2), "b")).To(BeNil())
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.batches).To(Equal([]int{1, 1}))
+	})
+
+	It("commits batches in parallel", func() {
+		loader.MaxMutations = 2
+		loader.Concurrency = 3
+		for i := 0; i < 30; i++ {
+			Expect(loader.Add(ctx, int64(i), "name")).To(BeNil())
+		}
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.batches).To(HaveLen(30))
+	})
+
+	It("rejects rows with the wrong number of values", func() {
+		Expect(loader.Add(ctx, int64(1))).ToNot(BeNil())
+	})
+
+	It("rejects values that do not fit in spanner", func() {
+		Expect(loader.Add(ctx, int64(1), make(chan int))).ToNot(BeNil())
+	})
+
+	It("retries transient errors", func() {
+		applier.errs = []error{status.Error(codes.Aborted, "aborted"), status.Error(codes.Unavailable, "unavailable")}
+		Expect(loader.Add(ctx, int64(1), "name")).To(BeNil())
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.calls).To(Equal(3))
+		Expect(applier.batches).To(Equal([]int{1}))
+	})
+
+	It("stops waiting for a running batch when ctx is done", func() {
+		loader.MaxMutations = 2
+		applier.block = make(chan struct{})
+		Expect(loader.Add(ctx, int64(1), "name")).To(BeNil())
+		Expect(loader.Add(ctx, int64(2), "name")).To(BeNil())
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		Expect(loader.Add(canceled, int64(3), "name")).To(Equal(context.Canceled))
+		close(applier.block)
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(applier.batches).To(Equal([]int{1, 1}))
+	})
+
+	It("reports the batches that failed", func() {
+		loader.MaxMutations = 4
+		applier.errs = []error{nil, status.Error(codes.AlreadyExists, "row exists")}
+		for i := 0; i < 5; i++ {
+			Expect(loader.Add(ctx, int64(i), "name")).To(BeNil())
+		}
+		err := loader.Flush(ctx)
+		Expect(err).ToNot(BeNil())
+		loadErr, ok := err.(*sqlspanner.BulkLoadError)
+		Expect(ok).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(loadErr.Batches).To(HaveLen(1))
+		Expect(loadErr.Batches[0].FirstRow).To(Equal(2))
+		Expect(loadErr.Batches[0].Rows).To(Equal(2))
+		Expect(spanner.ErrCode(loadErr.Batches[0].Err)).To(Equal(codes.AlreadyExists))
+		Expect(applier.batches).To(Equal([]int{2, 1}))
+		Expect(loader.Flush(ctx)).To(BeNil())
+	})
+})
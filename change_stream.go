@@ -0,0 +1,423 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// DataChangeRecord is a change to a table, read from a change stream
+type DataChangeRecord struct {
+	CommitTimestamp                      time.Time     `spanner:"commit_timestamp"`
+	RecordSequence                       string        `spanner:"record_sequence"`
+	ServerTransactionID                  string        `spanner:"server_transaction_id"`
+	IsLastRecordInTransactionInPartition bool          `spanner:"is_last_record_in_transaction_in_partition"`
+	TableName                            string        `spanner:"table_name"`
+	ColumnTypes                          []*ColumnType `spanner:"column_types"`
+	Mods                                 []*Mod        `spanner:"mods"`
+	// INSERT, UPDATE, or DELETE
+	ModType string `spanner:"mod_type"`
+	// OLD_AND_NEW_VALUES, NEW_VALUES, NEW_ROW, or NEW_ROW_AND_OLD_VALUES
+	ValueCaptureType                string `spanner:"value_capture_type"`
+	NumberOfRecordsInTransaction    int64  `spanner:"number_of_records_in_transaction"`
+	NumberOfPartitionsInTransaction int64  `spanner:"number_of_partitions_in_transaction"`
+	TransactionTag                  string `spanner:"transaction_tag"`
+	IsSystemTransaction             bool   `spanner:"is_system_transaction"`
+}
+
+// ColumnType is a column of the table a DataChangeRecord changed
+type ColumnType struct {
+	Name string `spanner:"name"`
+	// the column's type as json, like {"code": "STRING"}
+	Type            spanner.NullJSON `spanner:"type"`
+	IsPrimaryKey    bool             `spanner:"is_primary_key"`
+	OrdinalPosition int64            `spanner:"ordinal_position"`
+}
+
+// Mod is a changed row. Each value is a json object of column names to values
+type Mod struct {
+	Keys      spanner.NullJSON `spanner:"keys"`
+	NewValues spanner.NullJSON `spanner:"new_values"`
+	OldValues spanner.NullJSON `spanner:"old_values"`
+}
+
+// a row of a change stream query, it has one of its records
+type changeRecord struct {
+	DataChangeRecords      []*DataChangeRecord      `spanner:"data_change_record"`
+	HeartbeatRecords       []*heartbeatRecord       `spanner:"heartbeat_record"`
+	ChildPartitionsRecords []*childPartitionsRecord `spanner:"child_partitions_record"`
+}
+
+type heartbeatRecord struct {
+	Timestamp time.Time `spanner:"timestamp"`
+}
+
+type childPartitionsRecord struct {
+	StartTimestamp  time.Time         `spanner:"start_timestamp"`
+	RecordSequence  string            `spanner:"record_sequence"`
+	ChildPartitions []*childPartition `spanner:"child_partitions"`
+}
+
+type childPartition struct {
+	Token                 string   `spanner:"token"`
+	ParentPartitionTokens []string `spanner:"parent_partition_tokens"`
+}
+
+// ChangeStreamPartition is a partition of a change stream, and how far it has been read
+type ChangeStreamPartition struct {
+	// the root partition, that the stream is first read from, has no token
+	Token string
+	// records committed before this time have been delivered. Records committed at
+	// this time may have been, they are delivered again when the partition is resumed
+	Start time.Time
+}
+
+// CheckpointStore saves how far a ChangeStreamReader has read each partition,
+// so a reader that is restarted continues where the last one stopped
+type CheckpointStore interface {
+	// Load returns the partitions that are being read, or none to start a new read
+	Load(ctx context.Context) ([]ChangeStreamPartition, error)
+	// Save records a partition, and the time it has been read up to. It is called for
+	// new partitions before they are read, and after every record of a partition
+	Save(ctx context.Context, p ChangeStreamPartition) error
+	// Finish records that a partition was read completely
+	Finish(ctx context.Context, token string) error
+}
+
+// MemoryCheckpointStore keeps checkpoints until the process exits
+type MemoryCheckpointStore struct {
+	mu         sync.Mutex
+	partitions map[string]time.Time
+}
+
+func (m *MemoryCheckpointStore) Load(ctx context.Context) ([]ChangeStreamPartition, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ps []ChangeStreamPartition
+	for token, start := range m.partitions {
+		ps = append(ps, ChangeStreamPartition{Token: token, Start: start})
+	}
+	return ps, nil
+}
+
+func (m *MemoryCheckpointStore) Save(ctx context.Context, p ChangeStreamPartition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.partitions == nil {
+		m.partitions = make(map[string]time.Time)
+	}
+	m.partitions[p.Token] = p.Start
+	return nil
+}
+
+func (m *MemoryCheckpointStore) Finish(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.partitions, token)
+	return nil
+}
+
+var streamNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ChangeStreamReader reads a change stream, following its partitions as spanner
+// splits and merges them. Every partition is read with its own query, by the spanner
+// client of a connection from the db's pool
+//
+//	reader := sqlspanner.NewChangeStreamReader(db, "users_stream", time.Now())
+//	err := reader.Read(ctx, func(r *sqlspanner.DataChangeRecord) error {
+//		...
+//	})
+type ChangeStreamReader struct {
+	Stream string
+	// when the first read starts, later reads start from the Store's checkpoints
+	Start time.Time
+	// when to stop reading, the zero time reads until the context is canceled
+	End time.Time
+	// how often spanner sends a heartbeat for a partition without changes,
+	// each heartbeat is saved as a checkpoint
+	HeartbeatInterval time.Duration
+	Store             CheckpointStore
+
+	db *sql.DB
+	// runs a partition's query, calling each with the ChangeRecord column of every row
+	query func(ctx context.Context, stmt spanner.Statement, each func(records []spanner.NullRow) error) error
+}
+
+func NewChangeStreamReader(db *sql.DB, stream string, start time.Time) *ChangeStreamReader {
+	return &ChangeStreamReader{
+		Stream:            stream,
+		Start:             start,
+		HeartbeatInterval: 10 * time.Second,
+		Store:             &MemoryCheckpointStore{},
+		db:                db,
+	}
+}
+
+// Read delivers the stream's data change records to handle until End, or until
+// ctx is canceled. handle is not called concurrently. Records of a partition are
+// delivered in commit order, records of different partitions are not ordered.
+// A child partition is read once all of its parents were, so the changes to a
+// key are delivered in commit order.
+// A partition is checkpointed after handle returns, when handle returns an error
+// reading stops, and the record will be delivered again by the next read.
+// Records are delivered at least once: a partition is checkpointed at the commit
+// time of its last record, and the records committed at that time are delivered
+// again when it is resumed, so handle has to be idempotent
+func (r *ChangeStreamReader) Read(ctx context.Context, handle func(*DataChangeRecord) error) error {
+	if !streamNameRegexp.MatchString(r.Stream) {
+		return fmt.Errorf("invalid change stream name %q", r.Stream)
+	}
+	query := r.query
+	if query == nil {
+		// the rows are read with the spanner client, they are decoded the same way
+		// in every result mode
+		c, err := r.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		var client *spanner.Client
+		err = c.Raw(func(driverConn interface{}) error {
+			sc, ok := driverConn.(SpannerConn)
+			if !ok {
+				return fmt.Errorf("not a spanner connection: %T", driverConn)
+			}
+			client = sc.Client()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		query = func(ctx context.Context, stmt spanner.Statement, each func(records []spanner.NullRow) error) error {
+			err := client.Single().Query(ctx, stmt).Do(func(row *spanner.Row) error {
+				var records []spanner.NullRow
+				if err := row.Column(0, &records); err != nil {
+					return err
+				}
+				return each(records)
+			})
+			return spannerError(err)
+		}
+	}
+	partitions, err := r.Store.Load(ctx)
+	if err != nil {
+		return err
+	}
+	if len(partitions) == 0 {
+		root := ChangeStreamPartition{Start: r.Start}
+		if err := r.Store.Save(ctx, root); err != nil {
+			return err
+		}
+		partitions = append(partitions, root)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cr := &changeStreamRead{
+		reader:   r,
+		query:    query,
+		handle:   handle,
+		cancel:   cancel,
+		started:  make(map[string]bool),
+		finished: make(map[string]bool),
+		waiting:  make(map[string]*waitingPartition),
+	}
+	for _, p := range partitions {
+		cr.started[p.Token] = true
+	}
+	for _, p := range partitions {
+		cr.start(ctx, p)
+	}
+	cr.wg.Wait()
+	return cr.err
+}
+
+// the state of a Read, shared by the goroutine reading each partition
+type changeStreamRead struct {
+	reader *ChangeStreamReader
+	query  func(ctx context.Context, stmt spanner.Statement, each func(records []spanner.NullRow) error) error
+	handle func(*DataChangeRecord) error
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	started  map[string]bool
+	finished map[string]bool
+	// child partitions that were returned by a parent, and are not read yet
+	waiting map[string]*waitingPartition
+	err     error
+}
+
+// a child partition, and the partitions it was split or merged from. A merged
+// partition is returned by each of its parents
+type waitingPartition struct {
+	ChangeStreamPartition
+	parents []string
+}
+
+// reads p in its own goroutine, p has to be marked as started
+func (cr *changeStreamRead) start(ctx context.Context, p ChangeStreamPartition) {
+	cr.wg.Add(1)
+	go func() {
+		defer cr.wg.Done()
+		if err := cr.readPartition(ctx, p); err != nil {
+			cr.fail(err)
+		}
+	}()
+}
+
+// records the first error, and stops every partition
+func (cr *changeStreamRead) fail(err error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	if cr.err == nil {
+		cr.err = err
+	}
+	cr.cancel()
+}
+
+func (cr *changeStreamRead) readPartition(ctx context.Context, p ChangeStreamPartition) error {
+	r := cr.reader
+	stmt := spanner.Statement{
+		SQL: fmt.Sprintf("SELECT ChangeRecord FROM READ_%s(start_timestamp => @start, end_timestamp => @end, partition_token => @token, heartbeat_milliseconds => @heartbeat)", r.Stream),
+		Params: map[string]interface{}{
+			"start":     p.Start,
+			"end":       spanner.NullTime{Time: r.End, Valid: !r.End.IsZero()},
+			"token":     spanner.NullString{StringVal: p.Token, Valid: p.Token != ""},
+			"heartbeat": r.HeartbeatInterval.Milliseconds(),
+		},
+	}
+	err := cr.query(ctx, stmt, func(records []spanner.NullRow) error {
+		for _, record := range records {
+			if err := cr.process(ctx, p.Token, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// the children are saved before the partition is finished, so they are not
+	// lost when the read stops in between
+	for _, child := range cr.finish(p.Token) {
+		if err := r.Store.Save(ctx, child); err != nil {
+			return err
+		}
+		cr.start(ctx, child)
+	}
+	return r.Store.Finish(ctx, p.Token)
+}
+
+// marks the partition with token as finished, and returns the waiting children
+// whose parents are all finished. They are marked as started
+func (cr *changeStreamRead) finish(token string) []ChangeStreamPartition {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	cr.finished[token] = true
+	var ready []ChangeStreamPartition
+	for childToken, child := range cr.waiting {
+		done := true
+		for _, parent := range child.parents {
+			// a parent this read does not know was finished by an earlier read
+			known := cr.started[parent] || cr.waiting[parent] != nil
+			if known && !cr.finished[parent] {
+				done = false
+			}
+		}
+		if done {
+			delete(cr.waiting, childToken)
+			cr.started[childToken] = true
+			ready = append(ready, child.ChangeStreamPartition)
+		}
+	}
+	return ready
+}
+
+func (cr *changeStreamRead) process(ctx context.Context, token string, record spanner.NullRow) error {
+	rec, err := decodeChangeRecord(record)
+	if err != nil {
+		return err
+	}
+	store := cr.reader.Store
+	for _, dcr := range rec.DataChangeRecords {
+		cr.mu.Lock()
+		err := cr.handle(dcr)
+		cr.mu.Unlock()
+		if err != nil {
+			return err
+		}
+		if err := store.Save(ctx, ChangeStreamPartition{Token: token, Start: dcr.CommitTimestamp}); err != nil {
+			return err
+		}
+	}
+	for _, hb := range rec.HeartbeatRecords {
+		if err := store.Save(ctx, ChangeStreamPartition{Token: token, Start: hb.Timestamp}); err != nil {
+			return err
+		}
+	}
+	// the children are read once their parents finish
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+	for _, cpr := range rec.ChildPartitionsRecords {
+		for _, child := range cpr.ChildPartitions {
+			if cr.started[child.Token] || cr.waiting[child.Token] != nil {
+				continue
+			}
+			parents := child.ParentPartitionTokens
+			if len(parents) == 0 {
+				parents = []string{token}
+			}
+			cr.waiting[child.Token] = &waitingPartition{
+				ChangeStreamPartition: ChangeStreamPartition{Token: child.Token, Start: cpr.StartTimestamp},
+				parents:               parents,
+			}
+		}
+	}
+	return nil
+}
+
+func decodeChangeRecord(record spanner.NullRow) (*changeRecord, error) {
+	rec := &changeRecord{}
+	if !record.Valid {
+		return rec, nil
+	}
+	if err := record.Row.ToStruct(rec); err != nil {
+		return nil, fmt.Errorf("could not decode change record: %v", err)
+	}
+	return rec, nil
+}
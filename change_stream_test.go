@@ -0,0 +1,315 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type testHeartbeat struct {
+	Timestamp time.Time `spanner:"timestamp"`
+}
+
+type testChildPartition struct {
+	Token                 string   `spanner:"token"`
+	ParentPartitionTokens []string `spanner:"parent_partition_tokens"`
+}
+
+type testChildPartitions struct {
+	StartTimestamp  time.Time             `spanner:"start_timestamp"`
+	RecordSequence  string                `spanner:"record_sequence"`
+	ChildPartitions []*testChildPartition `spanner:"child_partitions"`
+}
+
+type testChangeRecord struct {
+	DataChangeRecord      []*sqlspanner.DataChangeRecord `spanner:"data_change_record"`
+	HeartbeatRecord       []*testHeartbeat               `spanner:"heartbeat_record"`
+	ChildPartitionsRecord []*testChildPartitions         `spanner:"child_partitions_record"`
+}
+
+// reads the ChangeRecord column of a row the way the driver returns it
+func changeRecordsThroughDriver(records []testChangeRecord) []spanner.NullRow {
+	row, err := spanner.NewRow([]string{"ChangeRecord"}, []interface{}{records})
+	Expect(err).To(BeNil())
+	r := sqlspanner.NewRowsFromSpannerRow(row)
+	dest := make([]driver.Value, 1)
+	Expect(r.Next(dest)).To(Succeed())
+	rows, ok := dest[0].([]spanner.NullRow)
+	Expect(ok).To(BeTrue())
+	return rows
+}
+
+func jsonValue(v interface{}) spanner.NullJSON {
+	return spanner.NullJSON{Value: v, Valid: true}
+}
+
+var _ = Describe("Change streams", func() {
+	commitTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	It("decodes data change records", func() {
+		rows := changeRecordsThroughDriver([]testChangeRecord{{
+			DataChangeRecord: []*sqlspanner.DataChangeRecord{{
+				CommitTimestamp:     commitTime,
+				RecordSequence:      "00000001",
+				ServerTransactionID: "tx1",
+				TableName:           "users",
+				ColumnTypes: []*sqlspanner.ColumnType{
+					{Name: "id", Type: jsonValue(map[string]string{"code": "INT64"}), IsPrimaryKey: true, OrdinalPosition: 1},
+				},
+				Mods: []*sqlspanner.Mod{
+					{Keys: jsonValue(map[string]string{"id": "1"}), NewValues: jsonValue(map[string]string{"name": "a"}), OldValues: jsonValue(map[string]string{})},
+				},
+				ModType:                      "UPDATE",
+				ValueCaptureType:             "OLD_AND_NEW_VALUES",
+				NumberOfRecordsInTransaction: 1,
+			}},
+		}})
+		Expect(rows).To(HaveLen(1))
+		records, heartbeats, children, err := sqlspanner.DecodeChangeRecord(rows[0])
+		Expect(err).To(BeNil())
+		Expect(heartbeats).To(BeEmpty())
+		Expect(children).To(BeEmpty())
+		Expect(records).To(HaveLen(1))
+		rec := records[0]
+		Expect(rec.CommitTimestamp.Equal(commitTime)).To(BeTrue())
+		Expect(rec.TableName).To(Equal("users"))
+		Expect(rec.ModType).To(Equal("UPDATE"))
+		Expect(rec.ColumnTypes).To(HaveLen(1))
+		Expect(rec.ColumnTypes[0].IsPrimaryKey).To(BeTrue())
+		Expect(rec.Mods).To(HaveLen(1))
+		Expect(rec.Mods[0].Keys.String()).To(Equal(`{"id":"1"}`))
+		Expect(rec.Mods[0].NewValues.String()).To(Equal(`{"name":"a"}`))
+	})
+
+	It("decodes heartbeats, and child partitions", func() {
+		rows := changeRecordsThroughDriver([]testChangeRecord{
+			{HeartbeatRecord: []*testHeartbeat{{Timestamp: commitTime}}},
+			{ChildPartitionsRecord: []*testChildPartitions{{
+				StartTimestamp: commitTime,
+				RecordSequence: "00000002",
+				ChildPartitions: []*testChildPartition{
+					{Token: "child1", ParentPartitionTokens: []string{"parent"}},
+					{Token: "child2", ParentPartitionTokens: []string{"parent"}},
+				},
+			}}},
+		})
+		Expect(rows).To(HaveLen(2))
+		_, heartbeats, _, err := sqlspanner.DecodeChangeRecord(rows[0])
+		Expect(err).To(BeNil())
+		Expect(heartbeats).To(HaveLen(1))
+		Expect(heartbeats[0].Equal(commitTime)).To(BeTrue())
+		_, _, children, err := sqlspanner.DecodeChangeRecord(rows[1])
+		Expect(err).To(BeNil())
+		Expect(children).To(HaveLen(2))
+		Expect(children).To(HaveKey("child1"))
+		Expect(children).To(HaveKey("child2"))
+	})
+
+	It("rejects invalid stream names", func() {
+		reader := sqlspanner.NewChangeStreamReader(nil, "users; DROP TABLE users", time.Now())
+		err := reader.Read(context.Background(), func(*sqlspanner.DataChangeRecord) error { return nil })
+		Expect(err).ToNot(BeNil())
+	})
+
+	Describe("reading", func() {
+		var (
+			ctx     context.Context
+			mu      sync.Mutex
+			rows    map[string][][]spanner.NullRow // the rows of each partition's query
+			queried []string
+			starts  map[string]time.Time
+			handled []string
+		)
+		at := func(seconds int) time.Time { return commitTime.Add(time.Duration(seconds) * time.Second) }
+		data := func(seconds int, seq string) []spanner.NullRow {
+			return changeRecordsThroughDriver([]testChangeRecord{{DataChangeRecord: []*sqlspanner.DataChangeRecord{
+				{CommitTimestamp: at(seconds), RecordSequence: seq, TableName: "users", ModType: "INSERT"},
+			}}})
+		}
+		children := func(seconds int, parents []string, tokens ...string) []spanner.NullRow {
+			cps := make([]*testChildPartition, len(tokens))
+			for i, t := range tokens {
+				cps[i] = &testChildPartition{Token: t, ParentPartitionTokens: parents}
+			}
+			return changeRecordsThroughDriver([]testChangeRecord{{ChildPartitionsRecord: []*testChildPartitions{
+				{StartTimestamp: at(seconds), RecordSequence: "0", ChildPartitions: cps},
+			}}})
+		}
+		query := func(ctx context.Context, stmt spanner.Statement, each func([]spanner.NullRow) error) error {
+			token := stmt.Params["token"].(spanner.NullString).StringVal
+			mu.Lock()
+			queried = append(queried, token)
+			starts[token] = stmt.Params["start"].(time.Time)
+			mu.Unlock()
+			for _, row := range rows[token] {
+				if err := each(row); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		handle := func(r *sqlspanner.DataChangeRecord) error {
+			handled = append(handled, r.RecordSequence)
+			return nil
+		}
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			rows = make(map[string][][]spanner.NullRow)
+			queried = nil
+			starts = make(map[string]time.Time)
+			handled = nil
+		})
+
+		It("follows child partitions, and reads a child of several parents once", func() {
+			rows[""] = [][]spanner.NullRow{children(1, nil, "a", "b")}
+			rows["a"] = [][]spanner.NullRow{data(2, "a1"), children(3, []string{"a", "b"}, "c")}
+			rows["b"] = [][]spanner.NullRow{children(3, []string{"a", "b"}, "c")}
+			rows["c"] = [][]spanner.NullRow{data(4, "c1")}
+			reader := sqlspanner.NewTestChangeStreamReader("users_stream", at(0), query)
+			Expect(reader.Read(ctx, handle)).To(Succeed())
+			Expect(queried).To(ConsistOf("", "a", "b", "c"))
+			Expect(starts[""]).To(Equal(at(0)))
+			Expect(starts["a"]).To(Equal(at(1)))
+			Expect(starts["c"]).To(Equal(at(3)))
+			Expect(handled).To(ConsistOf("a1", "c1"))
+			ps, err := reader.Store.Load(ctx)
+			Expect(err).To(BeNil())
+			Expect(ps).To(BeEmpty())
+		})
+
+		It("reads a merged partition once all of its parents were read", func() {
+			rows[""] = [][]spanner.NullRow{children(1, nil, "a", "b")}
+			rows["a"] = [][]spanner.NullRow{data(2, "a1"), children(3, []string{"a", "b"}, "c")}
+			rows["b"] = [][]spanner.NullRow{data(2, "b1"), children(3, []string{"a", "b"}, "c")}
+			rows["c"] = [][]spanner.NullRow{data(4, "c1")}
+			release := make(chan struct{})
+			reader := sqlspanner.NewTestChangeStreamReader("users_stream", at(0), func(ctx context.Context, stmt spanner.Statement, each func([]spanner.NullRow) error) error {
+				if stmt.Params["token"].(spanner.NullString).StringVal == "b" {
+					<-release
+				}
+				return query(ctx, stmt, each)
+			})
+			done := make(chan error)
+			go func() { done <- reader.Read(ctx, handle) }()
+			wasQueried := func() []string {
+				mu.Lock()
+				defer mu.Unlock()
+				return append([]string(nil), queried...)
+			}
+			Eventually(wasQueried).Should(ConsistOf("", "a"))
+			// a is finished, c waits for b
+			Consistently(wasQueried, "50ms").ShouldNot(ContainElement("c"))
+			close(release)
+			Eventually(done).Should(Receive(BeNil()))
+			Expect(queried).To(Equal([]string{"", "a", "b", "c"}))
+			Expect(handled).To(Equal([]string{"a1", "b1", "c1"}))
+		})
+
+		It("resumes the partitions of the checkpoint store", func() {
+			store := &sqlspanner.MemoryCheckpointStore{}
+			Expect(store.Save(ctx, sqlspanner.ChangeStreamPartition{Token: "a", Start: at(2)})).To(Succeed())
+			rows["a"] = [][]spanner.NullRow{data(2, "a1"), data(5, "a2")}
+			reader := sqlspanner.NewTestChangeStreamReader("users_stream", at(0), query)
+			reader.Store = store
+			Expect(reader.Read(ctx, handle)).To(Succeed())
+			Expect(queried).To(Equal([]string{"a"}))
+			Expect(starts["a"]).To(Equal(at(2)))
+			// the record at the checkpoint is delivered again
+			Expect(handled).To(Equal([]string{"a1", "a2"}))
+		})
+
+		It("stops at the first error of handle, and keeps the last checkpoint", func() {
+			rows[""] = [][]spanner.NullRow{data(1, "r1"), data(2, "r2")}
+			reader := sqlspanner.NewTestChangeStreamReader("users_stream", at(0), query)
+			failure := errors.New("handle failed")
+			err := reader.Read(ctx, func(r *sqlspanner.DataChangeRecord) error {
+				if r.RecordSequence == "r2" {
+					return failure
+				}
+				return nil
+			})
+			Expect(err).To(Equal(failure))
+			ps, err := reader.Store.Load(ctx)
+			Expect(err).To(BeNil())
+			Expect(ps).To(Equal([]sqlspanner.ChangeStreamPartition{{Token: "", Start: at(1)}}))
+		})
+
+		It("returns query errors", func() {
+			failure := errors.New("query failed")
+			reader := sqlspanner.NewTestChangeStreamReader("users_stream", at(0), func(context.Context, spanner.Statement, func([]spanner.NullRow) error) error {
+				return failure
+			})
+			Expect(reader.Read(ctx, handle)).To(Equal(failure))
+		})
+
+		It("stops when the context is canceled", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			reader := sqlspanner.NewTestChangeStreamReader("users_stream", at(0), func(ctx context.Context, _ spanner.Statement, _ func([]spanner.NullRow) error) error {
+				<-ctx.Done()
+				return ctx.Err()
+			})
+			done := make(chan error)
+			go func() { done <- reader.Read(ctx, handle) }()
+			cancel()
+			Eventually(done).Should(Receive(Equal(context.Canceled)))
+		})
+	})
+
+	Describe("the memory checkpoint store", func() {
+		It("remembers partitions until they are finished", func() {
+			ctx := context.Background()
+			store := &sqlspanner.MemoryCheckpointStore{}
+			ps, err := store.Load(ctx)
+			Expect(err).To(BeNil())
+			Expect(ps).To(BeEmpty())
+			Expect(store.Save(ctx, sqlspanner.ChangeStreamPartition{Token: "a", Start: commitTime})).To(Succeed())
+			Expect(store.Save(ctx, sqlspanner.ChangeStreamPartition{Token: "a", Start: commitTime.Add(time.Second)})).To(Succeed())
+			ps, err = store.Load(ctx)
+			Expect(err).To(BeNil())
+			Expect(ps).To(Equal([]sqlspanner.ChangeStreamPartition{{Token: "a", Start: commitTime.Add(time.Second)}}))
+			Expect(store.Finish(ctx, "a")).To(Succeed())
+			ps, err = store.Load(ctx)
+			Expect(err).To(BeNil())
+			Expect(ps).To(BeEmpty())
+		})
+	})
+})
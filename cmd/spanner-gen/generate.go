@@ -0,0 +1,394 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// the go types rows are scanned into, and args are written from, by spanner type.
+// They are the types the driver returns in its default result mode
+var (
+	notNullTypes = map[string]string{
+		"BOOL":      "bool",
+		"INT64":     "int64",
+		"FLOAT64":   "float64",
+		"STRING":    "string",
+		"BYTES":     "[]byte",
+		"TIMESTAMP": "time.Time",
+		"DATE":      "civil.Date",
+		"NUMERIC":   "*big.Rat",
+		"JSON":      "spanner.NullJSON",
+	}
+	nullableTypes = map[string]string{
+		"BOOL":      "spanner.NullBool",
+		"INT64":     "spanner.NullInt64",
+		"FLOAT64":   "spanner.NullFloat64",
+		"STRING":    "spanner.NullString",
+		"BYTES":     "[]byte",
+		"TIMESTAMP": "spanner.NullTime",
+		"DATE":      "spanner.NullDate",
+		"NUMERIC":   "spanner.NullNumeric",
+		"JSON":      "spanner.NullJSON",
+	}
+	// the packages a go type needs, besides spanner which is always imported
+	typeImports = map[string]string{
+		"time.":  "time",
+		"civil.": "cloud.google.com/go/civil",
+		"big.":   "math/big",
+	}
+)
+
+// STRING(MAX) is STRING
+var typeLengthRegexp = regexp.MustCompile(`\(\w+\)`)
+
+// the go type of a column
+func goType(c *column) (string, error) {
+	spannerType := typeLengthRegexp.ReplaceAllString(c.SpannerType, "")
+	if strings.HasPrefix(spannerType, "ARRAY<") && strings.HasSuffix(spannerType, ">") {
+		elem := strings.TrimSuffix(strings.TrimPrefix(spannerType, "ARRAY<"), ">")
+		if elem == "BYTES" {
+			return "[][]byte", nil
+		}
+		if t, ok := nullableTypes[elem]; ok {
+			return "[]" + t, nil
+		}
+	} else if c.Nullable {
+		if t, ok := nullableTypes[spannerType]; ok {
+			return t, nil
+		}
+	} else if t, ok := notNullTypes[spannerType]; ok {
+		return t, nil
+	}
+	return "", fmt.Errorf("column %s has the unsupported type %s", c.Name, c.SpannerType)
+}
+
+// words that are capitalized together in go names
+var initialisms = map[string]bool{
+	"API": true, "HTML": true, "HTTP": true, "ID": true, "IP": true, "JSON": true,
+	"SQL": true, "URI": true, "URL": true, "UUID": true,
+}
+
+// an exported go name for a table or column, user_id and UserId are both UserID
+func goName(name string) string {
+	var words []string
+	word := []rune{}
+	flush := func() {
+		if len(word) > 0 {
+			words = append(words, string(word))
+			word = word[:0]
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			word = append(word, r)
+		default:
+			word = append(word, r)
+		}
+	}
+	flush()
+	var b strings.Builder
+	for _, w := range words {
+		upper := strings.ToUpper(w)
+		if initialisms[upper] {
+			b.WriteString(upper)
+			continue
+		}
+		rs := []rune(w)
+		b.WriteRune(unicode.ToUpper(rs[0]))
+		b.WriteString(string(rs[1:]))
+	}
+	if b.Len() == 0 || unicode.IsDigit([]rune(b.String())[0]) {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// keywords spanner, or the mysql parser the driver uses, reserve
+var reserved = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`ALL AND ANY ARRAY AS ASC ASSERT_ROWS_MODIFIED AT BETWEEN BY CASE CAST
+		COLLATE CONTAINS CREATE CROSS CUBE CURRENT DEFAULT DEFINE DESC DISTINCT ELSE END ENUM ESCAPE
+		EXCEPT EXCLUDE EXISTS EXTRACT FALSE FETCH FOLLOWING FOR FROM FULL GROUP GROUPING GROUPS HASH
+		HAVING IF IGNORE IN INNER INTERSECT INTERVAL INTO IS JOIN LATERAL LEFT LIKE LIMIT LOOKUP MERGE
+		NATURAL NEW NO NOT NULL NULLS OF ON OR ORDER OUTER OVER PARTITION PRECEDING PROTO RANGE
+		RECURSIVE RESPECT RIGHT ROLLUP ROWS SELECT SET SOME STRUCT TABLESAMPLE THEN TO TREAT TRUE
+		UNBOUNDED UNION UNNEST USING WHEN WHERE WINDOW WITH WITHIN
+		ALTER BINARY CHECK COLUMN DATABASE DELETE DIV DROP DUAL DUPLICATE FORCE INDEX INSERT KEY
+		LOCK MOD MODE OFFSET PRIMARY REGEXP RENAME REPLACE SHARE SHOW STRAIGHT_JOIN TABLE UNIQUE
+		UPDATE USE VALUES VIEW XOR`) {
+		reserved[w] = true
+	}
+}
+
+var plainIdentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// quotes names that are keywords, or are not plain identifiers
+func quoteIdent(name string) string {
+	if plainIdentRegexp.MatchString(name) && !reserved[strings.ToUpper(name)] {
+		return name
+	}
+	return "`" + strings.Replace(name, "`", "\\`", -1) + "`"
+}
+
+// what the templates are given for a table
+type genTable struct {
+	Name    string // the table's name in spanner
+	GoName  string
+	Columns []*genColumn
+	Key     []*genColumn
+	// the columns written by inserts, and the non key columns written by updates
+	Inserted []*genColumn
+	Updated  []*genColumn
+
+	InsertSQL string
+	SelectSQL string
+	UpdateSQL string
+	DeleteSQL string
+}
+
+type genColumn struct {
+	Name   string
+	GoName string
+	GoType string
+}
+
+// generates a go file with a struct, key struct, and CRUD helpers for each table
+func generate(w io.Writer, pkg string, tables []*table) error {
+	var gen []*genTable
+	imports := map[string]bool{"context": true, "database/sql": true, "cloud.google.com/go/spanner": true}
+	goNames := make(map[string]string)
+	for _, t := range tables {
+		gt, err := newGenTable(t)
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{gt.GoName, gt.GoName + "Key", gt.GoName + "Columns"} {
+			if other, ok := goNames[name]; ok {
+				return fmt.Errorf("tables %s and %s are both named %s in go", other, t.Name, gt.GoName)
+			}
+			goNames[name] = t.Name
+		}
+		for _, c := range gt.Columns {
+			for prefix, pkg := range typeImports {
+				if strings.Contains(c.GoType, prefix) {
+					imports[pkg] = true
+				}
+			}
+		}
+		gen = append(gen, gt)
+	}
+	// standard packages are imported first, the way goimports groups them
+	var std, other []string
+	for pkg := range imports {
+		if strings.Contains(strings.Split(pkg, "/")[0], ".") {
+			other = append(other, pkg)
+		} else {
+			std = append(std, pkg)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, struct {
+		Package string
+		Imports [][]string
+		Tables  []*genTable
+	}{pkg, [][]string{std, other}, gen})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("formatting the generated code: %v", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func newGenTable(t *table) (*genTable, error) {
+	if len(t.PrimaryKey) == 0 {
+		return nil, fmt.Errorf("table %s has no primary key", t.Name)
+	}
+	gt := &genTable{Name: t.Name, GoName: goName(t.Name)}
+	byName := make(map[string]*genColumn)
+	fieldNames := make(map[string]string)
+	isKey := make(map[string]bool)
+	for _, c := range t.PrimaryKey {
+		isKey[c.Name] = true
+	}
+	for _, c := range t.Columns {
+		typ, err := goType(c)
+		if err != nil {
+			return nil, fmt.Errorf("table %s: %v", t.Name, err)
+		}
+		gc := &genColumn{Name: c.Name, GoName: goName(c.Name), GoType: typ}
+		if other, ok := fieldNames[gc.GoName]; ok {
+			return nil, fmt.Errorf("table %s: columns %s and %s are both named %s in go", t.Name, other, c.Name, gc.GoName)
+		}
+		fieldNames[gc.GoName] = c.Name
+		byName[c.Name] = gc
+		gt.Columns = append(gt.Columns, gc)
+		if c.Generated {
+			continue
+		}
+		gt.Inserted = append(gt.Inserted, gc)
+		if !isKey[c.Name] {
+			gt.Updated = append(gt.Updated, gc)
+		}
+	}
+	for _, c := range t.PrimaryKey {
+		gt.Key = append(gt.Key, byName[c.Name])
+	}
+
+	// the statements are written the way the driver's parsers expect them: inserts
+	// list their columns, and updates and deletes find their row by the whole primary
+	// key, in the key's order
+	table := quoteIdent(t.Name)
+	where := make([]string, len(gt.Key))
+	for i, c := range gt.Key {
+		where[i] = quoteIdent(c.Name) + " = ?"
+	}
+	gt.InsertSQL = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, columnList(gt.Inserted), placeholders(len(gt.Inserted)))
+	gt.SelectSQL = fmt.Sprintf("SELECT %s FROM %s WHERE %s", columnList(gt.Columns), table, strings.Join(where, " AND "))
+	gt.DeleteSQL = fmt.Sprintf("DELETE FROM %s WHERE %s", table, strings.Join(where, " AND "))
+	if len(gt.Updated) > 0 {
+		set := make([]string, len(gt.Updated))
+		for i, c := range gt.Updated {
+			set[i] = quoteIdent(c.Name) + " = ?"
+		}
+		gt.UpdateSQL = fmt.Sprintf("UPDATE %s SET %s WHERE %s", table, strings.Join(set, ", "), strings.Join(where, " AND "))
+	}
+	return gt, nil
+}
+
+func columnList(columns []*genColumn) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = quoteIdent(c.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by spanner-gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range $i, $group := .Imports}}{{if $i}}
+{{end}}
+{{- range $group}}
+	"{{.}}"
+{{- end}}
+{{- end}}
+)
+
+// DB runs the helpers' statements, it is a *sql.DB, *sql.Conn, or *sql.Tx
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+{{range .Tables}}{{$t := .}}
+// {{.GoName}} is a row of the {{.Name}} table
+type {{.GoName}} struct {
+{{- range .Columns}}
+	{{.GoName}} {{.GoType}} ` + "`" + `spanner:"{{.Name}}" db:"{{.Name}}"` + "`" + `
+{{- end}}
+}
+
+// {{.GoName}}Key is the primary key of the {{.Name}} table
+type {{.GoName}}Key struct {
+{{- range .Key}}
+	{{.GoName}} {{.GoType}}
+{{- end}}
+}
+
+// {{.GoName}}Columns are the columns of the {{.Name}} table, in order
+var {{.GoName}}Columns = []string{ {{- range $i, $c := .Columns}}{{if $i}}, {{end}}{{printf "%q" $c.Name}}{{end -}} }
+
+// Key returns the row's primary key
+func (r *{{.GoName}}) Key() {{.GoName}}Key {
+	return {{.GoName}}Key{ {{- range $i, $c := .Key}}{{if $i}}, {{end}}{{$c.GoName}}: r.{{$c.GoName}}{{end -}} }
+}
+
+// SpannerKey returns the key as a spanner.Key, for mutations and key sets
+func (k {{.GoName}}Key) SpannerKey() spanner.Key {
+	return spanner.Key{ {{- range $i, $c := .Key}}{{if $i}}, {{end}}k.{{$c.GoName}}{{end -}} }
+}
+
+// Insert{{.GoName}} inserts r into the {{.Name}} table
+func Insert{{.GoName}}(ctx context.Context, db DB, r *{{.GoName}}) error {
+	_, err := db.ExecContext(ctx, {{printf "%q" .InsertSQL}}{{range .Inserted}}, r.{{.GoName}}{{end}})
+	return err
+}
+
+// Get{{.GoName}} reads the {{.Name}} row with key, or returns sql.ErrNoRows when there isn't one
+func Get{{.GoName}}(ctx context.Context, db DB, key {{.GoName}}Key) (*{{.GoName}}, error) {
+	r := &{{.GoName}}{}
+	err := db.QueryRowContext(ctx, {{printf "%q" .SelectSQL}}{{range .Key}}, key.{{.GoName}}{{end}}).Scan(
+{{- range $i, $c := .Columns}}{{if $i}}, {{end}}&r.{{$c.GoName}}{{end -}} )
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+{{if .UpdateSQL}}
+// Update{{.GoName}} writes r's columns to the {{.Name}} row with r's key
+func Update{{.GoName}}(ctx context.Context, db DB, r *{{.GoName}}) error {
+	_, err := db.ExecContext(ctx, {{printf "%q" .UpdateSQL}}{{range .Updated}}, r.{{.GoName}}{{end}}{{range .Key}}, r.{{.GoName}}{{end}})
+	return err
+}
+{{end}}
+// Delete{{.GoName}} deletes the {{.Name}} row with key
+func Delete{{.GoName}}(ctx context.Context, db DB, key {{.GoName}}Key) error {
+	_, err := db.ExecContext(ctx, {{printf "%q" .DeleteSQL}}{{range .Key}}, key.{{.GoName}}{{end}})
+	return err
+}
+{{end}}`))
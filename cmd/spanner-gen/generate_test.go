@@ -0,0 +1,183 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner/fake"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("generate", func() {
+	userID := &column{Name: "UserId", SpannerType: "INT64"}
+	teamID := &column{Name: "team_id", SpannerType: "STRING(36)"}
+	users := &table{
+		Name: "Users",
+		Columns: []*column{
+			teamID,
+			userID,
+			{Name: "Name", SpannerType: "STRING(MAX)", Nullable: true},
+			{Name: "Order", SpannerType: "INT64"},
+			{Name: "Tags", SpannerType: "ARRAY<STRING(MAX)>", Nullable: true},
+			{Name: "Born", SpannerType: "DATE", Nullable: true},
+			{Name: "Created", SpannerType: "TIMESTAMP"},
+			{Name: "NameLength", SpannerType: "INT64", Nullable: true, Generated: true},
+		},
+		PrimaryKey: []*column{teamID, userID},
+	}
+	tagID := &column{Name: "TagId", SpannerType: "BYTES(16)"}
+	tags := &table{Name: "tags", Columns: []*column{tagID}, PrimaryKey: []*column{tagID}}
+
+	It("names columns and tables the go way", func() {
+		Expect(goName("user_id")).To(Equal("UserID"))
+		Expect(goName("UserId")).To(Equal("UserID"))
+		Expect(goName("HTTPServer")).To(Equal("HTTPServer"))
+		Expect(goName("2fa")).To(Equal("X2fa"))
+	})
+
+	It("quotes keywords and other identifiers that are not plain", func() {
+		Expect(quoteIdent("Users")).To(Equal("Users"))
+		Expect(quoteIdent("Order")).To(Equal("`Order`"))
+		Expect(quoteIdent("key")).To(Equal("`key`"))
+		Expect(quoteIdent("with-dash")).To(Equal("`with-dash`"))
+	})
+
+	It("uses the types the driver reads and writes", func() {
+		for spannerType, want := range map[string]string{
+			"INT64":             "int64",
+			"STRING(MAX)":       "string",
+			"NUMERIC":           "*big.Rat",
+			"ARRAY<BYTES(MAX)>": "[][]byte",
+			"ARRAY<TIMESTAMP>":  "[]spanner.NullTime",
+		} {
+			Expect(goType(&column{SpannerType: spannerType})).To(Equal(want), spannerType)
+		}
+		Expect(goType(&column{SpannerType: "DATE", Nullable: true})).To(Equal("spanner.NullDate"))
+		_, err := goType(&column{Name: "p", SpannerType: "PROTO<a.B>"})
+		Expect(err).To(MatchError("column p has the unsupported type PROTO<a.B>"))
+	})
+
+	It("writes structs, keys, and CRUD helpers", func() {
+		var out bytes.Buffer
+		Expect(generate(&out, "models", []*table{users, tags})).To(BeNil())
+		src := out.String()
+		Expect(src).To(HavePrefix("// Code generated by spanner-gen. DO NOT EDIT.\n\npackage models\n"))
+		Expect(src).NotTo(ContainSubstring(`"cloud.google.com/go/civil"`))
+		Expect(src).To(ContainSubstring(`"time"`))
+		Expect(src).To(ContainSubstring("\tTeamID     string               `spanner:\"team_id\" db:\"team_id\"`\n"))
+		Expect(src).To(ContainSubstring("\tBorn       spanner.NullDate     `spanner:\"Born\" db:\"Born\"`\n"))
+		Expect(src).To(ContainSubstring("type UsersKey struct {\n\tTeamID string\n\tUserID int64\n}"))
+		Expect(src).To(ContainSubstring(`var UsersColumns = []string{"team_id", "UserId", "Name", "Order", "Tags", "Born", "Created", "NameLength"}`))
+		Expect(src).To(ContainSubstring("return spanner.Key{k.TeamID, k.UserID}"))
+		// generated columns are read, but not written
+		Expect(src).To(ContainSubstring(`"INSERT INTO Users (team_id, UserId, Name, ` + "`Order`" + `, Tags, Born, Created) VALUES (?, ?, ?, ?, ?, ?, ?)", r.TeamID, r.UserID, r.Name, r.Order, r.Tags, r.Born, r.Created)`))
+		Expect(src).To(ContainSubstring(`"SELECT team_id, UserId, Name, ` + "`Order`" + `, Tags, Born, Created, NameLength FROM Users WHERE team_id = ? AND UserId = ?", key.TeamID, key.UserID).Scan(&r.TeamID, &r.UserID, &r.Name, &r.Order, &r.Tags, &r.Born, &r.Created, &r.NameLength)`))
+		Expect(src).To(ContainSubstring(`"UPDATE Users SET Name = ?, ` + "`Order`" + ` = ?, Tags = ?, Born = ?, Created = ? WHERE team_id = ? AND UserId = ?", r.Name, r.Order, r.Tags, r.Born, r.Created, r.TeamID, r.UserID)`))
+		Expect(src).To(ContainSubstring(`"DELETE FROM Users WHERE team_id = ? AND UserId = ?", key.TeamID, key.UserID)`))
+		// a table with only key columns has nothing to update
+		Expect(src).To(ContainSubstring("func InsertTags("))
+		Expect(src).NotTo(ContainSubstring("func UpdateTags("))
+	})
+
+	Describe("statements", func() {
+		var (
+			ctx    context.Context
+			fakeDB *fake.Database
+			db     *sql.DB
+		)
+
+		BeforeEach(func() {
+			ctx = context.Background()
+			var err error
+			fakeDB, db, err = fake.Open("spanner_gen_test", "CREATE TABLE Users (team_id STRING(36) NOT NULL, UserId INT64 NOT NULL, Name STRING(MAX), `Order` INT64 NOT NULL) PRIMARY KEY (team_id, UserId)")
+			Expect(err).To(BeNil())
+		})
+
+		AfterEach(func() {
+			Expect(fakeDB.Close()).To(BeNil())
+		})
+
+		It("are run by the driver, on a composite key and a keyword column", func() {
+			gt, err := newGenTable(&table{
+				Name:       "Users",
+				Columns:    []*column{teamID, userID, {Name: "Name", SpannerType: "STRING(MAX)", Nullable: true}, {Name: "Order", SpannerType: "INT64"}},
+				PrimaryKey: []*column{teamID, userID},
+			})
+			Expect(err).To(BeNil())
+			_, err = db.ExecContext(ctx, gt.InsertSQL, "a", int64(1), "ann", int64(5))
+			Expect(err).To(BeNil())
+			_, err = db.ExecContext(ctx, gt.InsertSQL, "b", int64(1), "bob", int64(6))
+			Expect(err).To(BeNil())
+
+			get := func(team string, id int64) (string, int64, error) {
+				var gotTeam string
+				var gotID, order int64
+				var name spanner.NullString
+				err := db.QueryRowContext(ctx, gt.SelectSQL, team, id).Scan(&gotTeam, &gotID, &name, &order)
+				return name.StringVal, order, err
+			}
+			name, order, err := get("a", 1)
+			Expect(err).To(BeNil())
+			Expect(name).To(Equal("ann"))
+			Expect(order).To(Equal(int64(5)))
+
+			_, err = db.ExecContext(ctx, gt.UpdateSQL, "amy", int64(7), "a", int64(1))
+			Expect(err).To(BeNil())
+			name, order, err = get("a", 1)
+			Expect(err).To(BeNil())
+			Expect(name).To(Equal("amy"))
+			Expect(order).To(Equal(int64(7)))
+
+			// only the row with the whole key is deleted
+			_, err = db.ExecContext(ctx, gt.DeleteSQL, "a", int64(1))
+			Expect(err).To(BeNil())
+			_, _, err = get("a", 1)
+			Expect(err).To(Equal(sql.ErrNoRows))
+			name, _, err = get("b", 1)
+			Expect(err).To(BeNil())
+			Expect(name).To(Equal("bob"))
+		})
+	})
+
+	It("rejects tables it cannot write helpers for", func() {
+		var out bytes.Buffer
+		err := generate(&out, "models", []*table{{Name: "nokey", Columns: []*column{userID}}})
+		Expect(err).To(MatchError("table nokey has no primary key"))
+		err = generate(&out, "models", []*table{{Name: "a", Columns: []*column{userID, {Name: "user_id", SpannerType: "INT64"}}, PrimaryKey: []*column{userID}}})
+		Expect(err).To(MatchError("table a: columns UserId and user_id are both named UserID in go"))
+	})
+})
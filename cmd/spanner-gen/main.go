@@ -0,0 +1,98 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// spanner-gen generates go structs, and helpers that read and write them through
+// the sqlspanner driver, for the tables in a spanner database. It reads the tables'
+// columns and primary keys from INFORMATION_SCHEMA
+//   spanner-gen -dsn projects/p/instances/i/databases/d -package models -o models/tables.go
+//   spanner-gen -dsn projects/p/instances/i/databases/d -tables Users,Teams
+//
+// For each table it writes a struct with spanner and db tags, a struct of the
+// primary key, and Insert, Get, Update, and Delete functions, with statements
+// the driver's parsers accept
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	_ "github.com/tcncloud/sqlspanner"
+)
+
+func main() {
+	dsn := flag.String("dsn", "", "the data source name of the database, like projects/p/instances/i/databases/d")
+	pkg := flag.String("package", "models", "the package of the generated file")
+	out := flag.String("o", "", "the file to write, instead of stdout")
+	tables := flag.String("tables", "", "a comma separated list of the tables to generate, instead of all of them")
+	flag.Parse()
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "spanner-gen: -dsn is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	only := make(map[string]bool)
+	for _, name := range strings.Split(*tables, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			only[name] = true
+		}
+	}
+	if err := run(context.Background(), *dsn, *pkg, only, *out, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "spanner-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, dsn, pkg string, only map[string]bool, out string, stdout *os.File) error {
+	db, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tables, err := loadSchema(ctx, db, only)
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := generate(&buf, pkg, tables); err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = stdout.Write(buf.Bytes())
+		return err
+	}
+	return ioutil.WriteFile(out, buf.Bytes(), 0644)
+}
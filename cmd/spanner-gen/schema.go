@@ -0,0 +1,151 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/spanner"
+)
+
+// a table, as INFORMATION_SCHEMA describes it
+type table struct {
+	Name       string
+	Columns    []*column
+	PrimaryKey []*column
+}
+
+type column struct {
+	Name string
+	// the type as it is written in DDL, like STRING(MAX) or ARRAY<INT64>
+	SpannerType string
+	Nullable    bool
+	// generated columns are read, but never written
+	Generated bool
+}
+
+// reads the tables in the default schema, and their columns and primary keys, sorted by name.
+// When only is not empty, only the tables in it are read
+func loadSchema(ctx context.Context, db *sql.DB, only map[string]bool) ([]*table, error) {
+	tables := make(map[string]*table)
+	rows, err := db.QueryContext(ctx, "SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = '' AND TABLE_TYPE = 'BASE TABLE'")
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(rows, func() error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if len(only) == 0 || only[name] {
+			tables[name] = &table{Name: name}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading INFORMATION_SCHEMA.TABLES: %v", err)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME, SPANNER_TYPE, IS_NULLABLE, IS_GENERATED FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = '' ORDER BY TABLE_NAME, ORDINAL_POSITION")
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(rows, func() error {
+		var tableName, name, spannerType, nullable string
+		var generated spanner.NullString
+		if err := rows.Scan(&tableName, &name, &spannerType, &nullable, &generated); err != nil {
+			return err
+		}
+		if t, ok := tables[tableName]; ok {
+			t.Columns = append(t.Columns, &column{
+				Name:        name,
+				SpannerType: spannerType,
+				Nullable:    nullable == "YES",
+				Generated:   generated.StringVal == "ALWAYS",
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading INFORMATION_SCHEMA.COLUMNS: %v", err)
+	}
+
+	rows, err = db.QueryContext(ctx, "SELECT TABLE_NAME, COLUMN_NAME FROM INFORMATION_SCHEMA.INDEX_COLUMNS WHERE TABLE_SCHEMA = '' AND INDEX_TYPE = 'PRIMARY_KEY' ORDER BY TABLE_NAME, ORDINAL_POSITION")
+	if err != nil {
+		return nil, err
+	}
+	err = scanAll(rows, func() error {
+		var tableName, name string
+		if err := rows.Scan(&tableName, &name); err != nil {
+			return err
+		}
+		t, ok := tables[tableName]
+		if !ok {
+			return nil
+		}
+		for _, c := range t.Columns {
+			if c.Name == name {
+				t.PrimaryKey = append(t.PrimaryKey, c)
+				return nil
+			}
+		}
+		return fmt.Errorf("primary key column %s.%s is not one of the table's columns", tableName, name)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("reading INFORMATION_SCHEMA.INDEX_COLUMNS: %v", err)
+	}
+
+	sorted := make([]*table, 0, len(tables))
+	for name := range only {
+		if _, ok := tables[name]; !ok {
+			return nil, fmt.Errorf("there is no table named %s", name)
+		}
+	}
+	for _, t := range tables {
+		sorted = append(sorted, t)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted, nil
+}
+
+// calls scan for each row, and closes the rows
+func scanAll(rows *sql.Rows, scan func() error) error {
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,295 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// spanner-sql is a console for spanner databases, that runs statements through
+// the sqlspanner driver, the same way services using the driver do.
+//
+//   spanner-sql projects/p/instances/i/databases/d
+//   spanner-sql -dsn projects/p/instances/i/databases/d migrate -dir migrations up
+//   spanner-sql -dsn projects/p/instances/i/databases/d export -table users -o users.jsonl
+//   spanner-sql -dsn projects/p/instances/i/databases/d import -table users users.jsonl
+//   spanner-sql -dsn projects/p/instances/i/databases/d -format csv -f report.sql
+//   echo "SELECT * FROM users;" | spanner-sql -dsn projects/p/instances/i/databases/d -format json
+//
+// Statements end with a semicolon. BEGIN, COMMIT, and ROLLBACK run a
+// transaction, and these commands are run on their own line:
+//   \timing [on|off]           print how long each statement took
+//   \format table|csv|json     how query results are printed
+//   \q                         quit
+//
+// The migrate subcommand applies and rolls back the migrations in a directory,
+// with the migrate package: migrate up [version], migrate down <version>, and
+// migrate status. The export and import subcommands write a table or query to
+// a CSV or JSONL file, and load one into a table, with the transfer package
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/tcncloud/sqlspanner"
+)
+
+// the subcommands, they are given the arguments after their name
+var subcommands = map[string]func(ctx context.Context, dsn string, args []string, out, errOut io.Writer) error{
+	"migrate": runMigrate,
+	"export":  runExport,
+	"import":  runImport,
+}
+
+func main() {
+	dsn := flag.String("dsn", "", "the data source name of the database, like projects/p/instances/i/databases/d")
+	file := flag.String("f", "", "run the statements in this file, instead of reading them from stdin")
+	format := flag.String("format", "table", "how query results are printed: table, csv, or json")
+	keepGoing := flag.Bool("continue", false, "keep running statements from a file or stdin after one fails")
+	flag.Parse()
+	args := flag.Args()
+	if *dsn == "" && len(args) > 0 && subcommands[args[0]] == nil {
+		*dsn = args[0]
+		args = args[1:]
+	}
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "spanner-sql: -dsn is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if !validFormat(*format) {
+		fmt.Fprintf(os.Stderr, "spanner-sql: unknown format %q\n", *format)
+		os.Exit(2)
+	}
+
+	if len(args) > 0 && subcommands[args[0]] != nil {
+		if err := subcommands[args[0]](context.Background(), *dsn, args[1:], os.Stdout, os.Stderr); err != nil {
+			fmt.Fprintf(os.Stderr, "spanner-sql: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	in := io.Reader(os.Stdin)
+	interactive := false
+	if *file != "" {
+		f, err := os.Open(*file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "spanner-sql: %v\n", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	} else if stat, err := os.Stdin.Stat(); err == nil && stat.Mode()&os.ModeCharDevice != 0 {
+		interactive = true
+	}
+
+	ctx := context.Background()
+	sh, err := newShell(ctx, *dsn, os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "spanner-sql: %v\n", err)
+		os.Exit(1)
+	}
+	defer sh.close()
+	sh.format = strings.ToLower(*format)
+	// statements typed at the prompt can be fixed and typed again
+	sh.keepGoing = *keepGoing || interactive
+	sh.interactive = interactive
+	if err := sh.runInput(ctx, in); err != nil {
+		os.Exit(1)
+	}
+}
+
+type shell struct {
+	db   *sql.DB
+	conn *sql.Conn
+	// the running transaction, statements run in it until COMMIT or ROLLBACK
+	tx *sql.Tx
+
+	out    io.Writer
+	errOut io.Writer
+
+	format      string
+	timing      bool
+	keepGoing   bool
+	interactive bool
+}
+
+// opens a single connection, so transactions, batches, and SET statements last
+// between statements
+func newShell(ctx context.Context, dsn string, out, errOut io.Writer) (*shell, error) {
+	db, err := sql.Open("spanner", standardResults(dsn))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &shell{db: db, conn: conn, out: out, errOut: errOut, format: "table"}, nil
+}
+
+// the shell prints standard driver values, unless the dsn asks for another result mode
+func standardResults(dsn string) string {
+	if strings.Contains(dsn, "resultMode=") {
+		return dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&resultMode=standard"
+	}
+	return dsn + "?resultMode=standard"
+}
+
+func (sh *shell) close() {
+	if sh.tx != nil {
+		sh.tx.Rollback()
+	}
+	sh.conn.Close()
+	sh.db.Close()
+}
+
+// runs the statements and commands read from in, until it ends or \q. It returns
+// the first error, when the shell does not keep going after errors
+func (sh *shell) runInput(ctx context.Context, in io.Reader) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var pending string
+	sh.prompt(pending)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(pending) == "" && strings.HasPrefix(strings.TrimSpace(line), `\`) {
+			quit, err := sh.command(strings.TrimSpace(line))
+			if quit {
+				return nil
+			}
+			if err := sh.report(err); err != nil {
+				return err
+			}
+			pending = ""
+			sh.prompt(pending)
+			continue
+		}
+		var stmts []string
+		stmts, pending = sqlspanner.SplitStatements(pending + line + "\n")
+		for _, stmt := range stmts {
+			if err := sh.report(sh.run(ctx, stmt)); err != nil {
+				return err
+			}
+		}
+		sh.prompt(pending)
+	}
+	if err := scanner.Err(); err != nil {
+		return sh.report(err)
+	}
+	// the last statement does not need a semicolon
+	stmts, rest := sqlspanner.SplitStatements(pending + ";")
+	if strings.TrimSpace(rest) != "" {
+		// an unterminated string or comment, spanner reports what is wrong with it
+		stmts = append(stmts, strings.TrimSpace(rest))
+	}
+	for _, stmt := range stmts {
+		if err := sh.report(sh.run(ctx, stmt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (sh *shell) prompt(pending string) {
+	if !sh.interactive {
+		return
+	}
+	if strings.TrimSpace(pending) == "" {
+		fmt.Fprint(sh.errOut, "spanner> ")
+	} else {
+		fmt.Fprint(sh.errOut, "      -> ")
+	}
+}
+
+// prints err, and returns it when the shell should stop
+func (sh *shell) report(err error) error {
+	if err == nil {
+		return nil
+	}
+	fmt.Fprintf(sh.errOut, "ERROR: %v\n", err)
+	if sh.keepGoing {
+		return nil
+	}
+	return err
+}
+
+// runs a backslash command, quit is set for \q
+func (sh *shell) command(line string) (quit bool, err error) {
+	fields := strings.Fields(line)
+	switch fields[0] {
+	case `\q`, `\quit`:
+		return true, nil
+	case `\timing`:
+		switch {
+		case len(fields) == 1:
+			sh.timing = !sh.timing
+		case strings.EqualFold(fields[1], "on"):
+			sh.timing = true
+		case strings.EqualFold(fields[1], "off"):
+			sh.timing = false
+		default:
+			return false, fmt.Errorf(`\timing takes on or off, not %q`, fields[1])
+		}
+		if sh.timing {
+			fmt.Fprintln(sh.errOut, "Timing is on.")
+		} else {
+			fmt.Fprintln(sh.errOut, "Timing is off.")
+		}
+		return false, nil
+	case `\format`:
+		if len(fields) != 2 || !validFormat(fields[1]) {
+			return false, fmt.Errorf(`\format takes table, csv, or json`)
+		}
+		sh.format = strings.ToLower(fields[1])
+		return false, nil
+	case `\?`, `\help`:
+		fmt.Fprintln(sh.errOut, `\timing [on|off]        print how long each statement took`)
+		fmt.Fprintln(sh.errOut, `\format table|csv|json  how query results are printed`)
+		fmt.Fprintln(sh.errOut, `\q                      quit`)
+		return false, nil
+	}
+	return false, fmt.Errorf("unknown command %s, \\? lists the commands", fields[0])
+}
+
+func validFormat(format string) bool {
+	switch strings.ToLower(format) {
+	case "table", "csv", "json":
+		return true
+	}
+	return false
+}
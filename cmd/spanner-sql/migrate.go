@@ -0,0 +1,120 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/tcncloud/sqlspanner/migrate"
+)
+
+const migrateUsage = `usage: spanner-sql -dsn <dsn> migrate [-dir migrations] <command>
+
+commands:
+  up [version]    apply the migrations that have not been applied, up to version
+  down <version>  roll back the migrations newer than version, 0 rolls back every one
+  status          list the migrations, and whether they have been applied
+`
+
+// runs the migrate subcommand, args are the ones after "migrate"
+func runMigrate(ctx context.Context, dsn string, args []string, out, errOut io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() { fmt.Fprint(errOut, migrateUsage) }
+	dir := flags.String("dir", "migrations", "the directory of NNN_name.up.sql and NNN_name.down.sql files")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	args = flags.Args()
+	if len(args) == 0 {
+		flags.Usage()
+		return fmt.Errorf("migrate needs a command")
+	}
+	migrations, err := migrate.LoadDir(*dir)
+	if err != nil {
+		return err
+	}
+	db, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m := migrate.New(db, migrations)
+	m.Log = errOut
+
+	version := func() (int64, error) {
+		if len(args) != 2 {
+			return 0, fmt.Errorf("migrate %s takes one version", args[0])
+		}
+		return strconv.ParseInt(args[1], 10, 64)
+	}
+	switch args[0] {
+	case "up":
+		if len(args) == 1 {
+			return m.Up(ctx)
+		}
+		v, err := version()
+		if err != nil {
+			return err
+		}
+		return m.UpTo(ctx, v)
+	case "down":
+		v, err := version()
+		if err != nil {
+			return err
+		}
+		return m.DownTo(ctx, v)
+	case "status":
+		applied, err := m.Applied(ctx)
+		if err != nil {
+			return err
+		}
+		isApplied := make(map[int64]bool, len(applied))
+		for _, v := range applied {
+			isApplied[v] = true
+		}
+		for _, mig := range migrations {
+			state := "pending"
+			if isApplied[mig.Version] {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "%-8s %s\n", state, mig)
+		}
+		return nil
+	}
+	flags.Usage()
+	return fmt.Errorf("unknown migrate command %q", args[0])
+}
@@ -0,0 +1,296 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tcncloud/sqlspanner"
+)
+
+var (
+	beginRegexp    = regexp.MustCompile(`(?i)^(BEGIN|START)(\s+TRANSACTION)?$`)
+	commitRegexp   = regexp.MustCompile(`(?i)^COMMIT(\s+TRANSACTION)?$`)
+	rollbackRegexp = regexp.MustCompile(`(?i)^ROLLBACK(\s+TRANSACTION)?$`)
+)
+
+// the connection or transaction statements run on
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// runs a statement and prints its result
+func (sh *shell) run(ctx context.Context, stmt string) error {
+	start := time.Now()
+	err := sh.runStatement(ctx, stmt)
+	if sh.timing {
+		fmt.Fprintf(sh.errOut, "Time: %s\n", time.Since(start).Round(time.Microsecond))
+	}
+	return err
+}
+
+func (sh *shell) runStatement(ctx context.Context, stmt string) error {
+	switch {
+	case beginRegexp.MatchString(stmt):
+		if sh.tx != nil {
+			return fmt.Errorf("a transaction is already running, COMMIT or ROLLBACK it first")
+		}
+		tx, err := sh.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		sh.tx = tx
+		fmt.Fprintln(sh.errOut, "BEGIN")
+		return nil
+	case commitRegexp.MatchString(stmt):
+		if sh.tx == nil {
+			return fmt.Errorf("there is no transaction to COMMIT")
+		}
+		tx := sh.tx
+		sh.tx = nil
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		fmt.Fprintln(sh.errOut, "COMMIT")
+		return nil
+	case rollbackRegexp.MatchString(stmt):
+		if sh.tx == nil {
+			return fmt.Errorf("there is no transaction to ROLLBACK")
+		}
+		tx := sh.tx
+		sh.tx = nil
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		fmt.Fprintln(sh.errOut, "ROLLBACK")
+		return nil
+	}
+
+	var q querier = sh.conn
+	if sh.tx != nil {
+		q = sh.tx
+	}
+	if sqlspanner.IsQuery(stmt) {
+		rows, err := q.QueryContext(ctx, stmt)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		return sh.printRows(rows)
+	}
+	result, err := q.ExecContext(ctx, stmt)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected > 0 {
+		fmt.Fprintf(sh.errOut, "%d rows affected\n", affected)
+	} else {
+		fmt.Fprintln(sh.errOut, "OK")
+	}
+	return nil
+}
+
+// reads every row, and prints them in the shell's format
+func (sh *shell) printRows(rows *sql.Rows) error {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+	names := make([]string, len(types))
+	typeNames := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.Name()
+		typeNames[i] = t.DatabaseTypeName()
+	}
+	var values [][]interface{}
+	for rows.Next() {
+		row := make([]interface{}, len(types))
+		dest := make([]interface{}, len(types))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+		values = append(values, row)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	switch sh.format {
+	case "csv":
+		return writeCSV(sh.out, names, typeNames, values)
+	case "json":
+		return writeJSON(sh.out, names, typeNames, values)
+	}
+	writeTable(sh.out, names, typeNames, values)
+	if len(values) == 1 {
+		fmt.Fprintln(sh.errOut, "(1 row)")
+	} else {
+		fmt.Fprintf(sh.errOut, "(%d rows)\n", len(values))
+	}
+	return nil
+}
+
+// prints the rows as a table with aligned columns
+//   id | name
+//   ---+------
+//   1  | alice
+func writeTable(out io.Writer, names, typeNames []string, values [][]interface{}) {
+	cells := make([][]string, len(values))
+	widths := make([]int, len(names))
+	for i, name := range names {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+	for r, row := range values {
+		cells[r] = make([]string, len(row))
+		for i, v := range row {
+			cells[r][i] = formatValue(v, typeNames[i])
+			if w := utf8.RuneCountInString(cells[r][i]); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+	writeTableRow(out, names, widths)
+	rule := make([]string, len(names))
+	for i, w := range widths {
+		rule[i] = strings.Repeat("-", w)
+	}
+	fmt.Fprintln(out, strings.Join(rule, "-+-"))
+	for _, row := range cells {
+		writeTableRow(out, row, widths)
+	}
+}
+
+func writeTableRow(out io.Writer, cells []string, widths []int) {
+	padded := make([]string, len(cells))
+	for i, cell := range cells {
+		padded[i] = cell + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+	}
+	fmt.Fprintln(out, strings.TrimRight(strings.Join(padded, " | "), " "))
+}
+
+// prints the rows as csv, with a header of the column names. NULL is an empty field
+func writeCSV(out io.Writer, names, typeNames []string, values [][]interface{}) error {
+	w := csv.NewWriter(out)
+	if err := w.Write(names); err != nil {
+		return err
+	}
+	for _, row := range values {
+		record := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				record[i] = formatValue(v, typeNames[i])
+			}
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// prints the rows as a json array, with an object for each row keyed by column name
+func writeJSON(out io.Writer, names, typeNames []string, values [][]interface{}) error {
+	objects := make([]map[string]interface{}, len(values))
+	for r, row := range values {
+		objects[r] = make(map[string]interface{}, len(row))
+		for i, v := range row {
+			objects[r][names[i]] = jsonValue(v, typeNames[i])
+		}
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(objects)
+}
+
+// the text for a value read in the standard result mode
+func formatValue(v interface{}, typeName string) string {
+	switch t := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		if typeName == "BYTES" || typeName == "ARRAY<BYTES>" {
+			return base64.StdEncoding.EncodeToString(t)
+		}
+		// JSON values
+		return string(t)
+	case time.Time:
+		if typeName == "DATE" || typeName == "ARRAY<DATE>" {
+			return t.Format("2006-01-02")
+		}
+		return t.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64)
+	case []interface{}:
+		elemType := strings.TrimSuffix(strings.TrimPrefix(typeName, "ARRAY<"), ">")
+		elems := make([]string, len(t))
+		for i, e := range t {
+			elems[i] = formatValue(e, elemType)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return fmt.Sprint(v)
+}
+
+// the json for a value read in the standard result mode, JSON columns are
+// included as json instead of as strings
+func jsonValue(v interface{}, typeName string) interface{} {
+	switch t := v.(type) {
+	case nil, bool, int64, float64, string:
+		return t
+	case []byte:
+		if typeName == "JSON" || typeName == "ARRAY<JSON>" {
+			return json.RawMessage(t)
+		}
+	case []interface{}:
+		elemType := strings.TrimSuffix(strings.TrimPrefix(typeName, "ARRAY<"), ">")
+		elems := make([]interface{}, len(t))
+		for i, e := range t {
+			elems[i] = jsonValue(e, elemType)
+		}
+		return elems
+	}
+	return formatValue(v, typeName)
+}
@@ -0,0 +1,204 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"github.com/tcncloud/sqlspanner/fake"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("formatValue", func() {
+	It("formats standard values by their column type", func() {
+		day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+		Expect(formatValue(nil, "STRING")).To(Equal("NULL"))
+		Expect(formatValue([]byte{0xff, 0x00}, "BYTES")).To(Equal("/wA="))
+		Expect(formatValue([]byte(`{"a":1}`), "JSON")).To(Equal(`{"a":1}`))
+		Expect(formatValue(day, "DATE")).To(Equal("2024-03-01"))
+		Expect(formatValue(day, "TIMESTAMP")).To(Equal("2024-03-01T00:00:00Z"))
+		Expect(formatValue(1.5, "FLOAT64")).To(Equal("1.5"))
+		Expect(formatValue([]interface{}{int64(1), nil}, "ARRAY<INT64>")).To(Equal("[1, NULL]"))
+	})
+
+	It("keeps JSON columns as json in json output", func() {
+		var out bytes.Buffer
+		Expect(writeJSON(&out, []string{"id", "doc"}, []string{"INT64", "JSON"}, [][]interface{}{{int64(1), []byte(`{"a":1}`)}})).To(BeNil())
+		Expect(out.String()).To(MatchJSON(`[{"id": 1, "doc": {"a": 1}}]`))
+	})
+})
+
+var _ = Describe("shell", func() {
+	var (
+		ctx         context.Context
+		fakeDB      *fake.Database
+		sh          *shell
+		out, errOut bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		out.Reset()
+		errOut.Reset()
+		var err error
+		fakeDB, err = fake.New("spanner_sql_test")
+		Expect(err).To(BeNil())
+		sh, err = newShell(ctx, fakeDB.DSN(), &out, &errOut)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		sh.close()
+		Expect(fakeDB.Close()).To(BeNil())
+	})
+
+	run := func(input string) error {
+		return sh.runInput(ctx, strings.NewReader(input))
+	}
+
+	seed := func() {
+		Expect(run("CREATE TABLE users (id INT64 NOT NULL, name STRING(MAX)) PRIMARY KEY (id);")).To(BeNil())
+		Expect(sqlspanner.WriteMutations(ctx, sh.conn,
+			spanner.Insert("users", []string{"id", "name"}, []interface{}{1, "alice"}),
+			spanner.Insert("users", []string{"id", "name"}, []interface{}{2, nil}),
+		)).To(BeNil())
+		out.Reset()
+	}
+
+	It("prints query results as an aligned table", func() {
+		seed()
+		Expect(run("SELECT id, name FROM users ORDER BY id;")).To(BeNil())
+		Expect(out.String()).To(Equal("id | name\n---+------\n1  | alice\n2  | NULL\n"))
+		Expect(errOut.String()).To(ContainSubstring("(2 rows)"))
+	})
+
+	It("prints query results as csv and json", func() {
+		seed()
+		Expect(run("\\format csv\nSELECT id, name FROM users ORDER BY id;\n")).To(BeNil())
+		Expect(out.String()).To(Equal("id,name\n1,alice\n2,\n"))
+		out.Reset()
+		Expect(run("\\format json\nSELECT id, name FROM users ORDER BY id")).To(BeNil())
+		Expect(out.String()).To(MatchJSON(`[{"id": 1, "name": "alice"}, {"id": 2, "name": null}]`))
+	})
+
+	It("prints timing when it is on", func() {
+		seed()
+		Expect(run("\\timing on\nSELECT 1;")).To(BeNil())
+		Expect(errOut.String()).To(ContainSubstring("Timing is on."))
+		Expect(errOut.String()).To(ContainSubstring("Time: "))
+	})
+
+	It("runs statements in a transaction until it is committed or rolled back", func() {
+		seed()
+		Expect(run("BEGIN;\nSELECT name FROM users WHERE id = 1;\nROLLBACK;")).To(BeNil())
+		Expect(sh.tx).To(BeNil())
+		Expect(errOut.String()).To(ContainSubstring("BEGIN"))
+		Expect(errOut.String()).To(ContainSubstring("ROLLBACK"))
+		Expect(run("COMMIT;")).NotTo(BeNil())
+	})
+
+	It("stops at the first error, unless it keeps going", func() {
+		seed()
+		Expect(run("SELECT * FROM missing;\nSELECT 1;")).NotTo(BeNil())
+		Expect(out.String()).To(BeEmpty())
+		sh.keepGoing = true
+		Expect(run("SELECT * FROM missing;\nSELECT 1 AS one;")).To(BeNil())
+		Expect(errOut.String()).To(ContainSubstring("ERROR: "))
+		Expect(out.String()).To(ContainSubstring("one"))
+	})
+
+	It("rejects unknown commands", func() {
+		Expect(run("\\nope")).NotTo(BeNil())
+		Expect(run("\\q\nSELECT * FROM missing;")).To(BeNil())
+	})
+})
+
+var _ = Describe("migrate", func() {
+	It("applies the migrations in a directory, and lists them", func() {
+		ctx := context.Background()
+		fakeDB, err := fake.New("spanner_sql_migrate_test")
+		Expect(err).To(BeNil())
+		defer fakeDB.Close()
+		dir, err := os.MkdirTemp("", "migrations")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		Expect(os.WriteFile(filepath.Join(dir, "001_create_users.up.sql"), []byte("CREATE TABLE users (id INT64 NOT NULL) PRIMARY KEY (id);"), 0644)).To(BeNil())
+		Expect(os.WriteFile(filepath.Join(dir, "002_create_teams.up.sql"), []byte("CREATE TABLE teams (id INT64 NOT NULL) PRIMARY KEY (id);"), 0644)).To(BeNil())
+
+		var out, errOut bytes.Buffer
+		Expect(runMigrate(ctx, fakeDB.DSN(), []string{"-dir", dir, "up", "1"}, &out, &errOut)).To(BeNil())
+		Expect(runMigrate(ctx, fakeDB.DSN(), []string{"-dir", dir, "status"}, &out, &errOut)).To(BeNil())
+		Expect(out.String()).To(Equal("applied  1_create_users\npending  2_create_teams\n"))
+		Expect(runMigrate(ctx, fakeDB.DSN(), []string{"-dir", dir, "sideways"}, &out, &errOut)).NotTo(BeNil())
+	})
+})
+
+var _ = Describe("export and import", func() {
+	It("copies a table through a file", func() {
+		ctx := context.Background()
+		fakeDB, err := fake.New("spanner_sql_transfer_test")
+		Expect(err).To(BeNil())
+		defer fakeDB.Close()
+		Expect(fakeDB.UpdateDDL(
+			"CREATE TABLE users (id INT64 NOT NULL, name STRING(MAX)) PRIMARY KEY (id)",
+			"CREATE TABLE copies (id INT64 NOT NULL, name STRING(MAX)) PRIMARY KEY (id)",
+		)).To(BeNil())
+		dir, err := os.MkdirTemp("", "transfer")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "users.jsonl")
+		Expect(os.WriteFile(file, []byte(`{"id":1,"name":"a"}`+"\n"+`{"id":2,"name":null}`+"\n"), 0644)).To(BeNil())
+
+		var out, errOut bytes.Buffer
+		Expect(runImport(ctx, fakeDB.DSN(), []string{"-table", "users", file}, &out, &errOut)).To(BeNil())
+		Expect(errOut.String()).To(Equal("imported 2 rows\n"))
+		Expect(runExport(ctx, fakeDB.DSN(), []string{"-table", "users", "-format", "csv"}, &out, &errOut)).To(BeNil())
+		Expect(out.String()).To(Equal("id,name\n1,a\n2,\\N\n"))
+
+		copied := filepath.Join(dir, "copies.csv")
+		Expect(os.WriteFile(copied, out.Bytes(), 0644)).To(BeNil())
+		Expect(runImport(ctx, fakeDB.DSN(), []string{"-table", "copies", copied}, &out, &errOut)).To(BeNil())
+		out.Reset()
+		Expect(runExport(ctx, fakeDB.DSN(), []string{"-query", "SELECT * FROM copies ORDER BY id", "-format", "jsonl"}, &out, &errOut)).To(BeNil())
+		Expect(out.String()).To(Equal(`{"id":1,"name":"a"}` + "\n" + `{"id":2,"name":null}` + "\n"))
+
+		Expect(runExport(ctx, fakeDB.DSN(), []string{"-table", "users", "-query", "SELECT 1"}, &out, &errOut)).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,164 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tcncloud/sqlspanner/transfer"
+)
+
+const exportUsage = `usage: spanner-sql -dsn <dsn> export [-format csv|jsonl] [-o file] -table <table> | -query <query>
+
+writes a table, or the rows of a query, to the file or stdout. The format is
+guessed from the file's extension when it is not given, .jsonl and .ndjson are
+jsonl, and everything else is csv
+`
+
+const importUsage = `usage: spanner-sql -dsn <dsn> import [-format csv|jsonl] [-upsert] -table <table> [file]
+
+loads the rows of a csv or jsonl file, or stdin, into a table
+`
+
+// runs the export subcommand, args are the ones after "export"
+func runExport(ctx context.Context, dsn string, args []string, out, errOut io.Writer) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() { fmt.Fprint(errOut, exportUsage) }
+	table := flags.String("table", "", "the table to export")
+	query := flags.String("query", "", "the query whose rows are exported")
+	file := flags.String("o", "", "the file to write, instead of stdout")
+	formatName := flags.String("format", "", "csv, or jsonl")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*table == "") == (*query == "") || flags.NArg() > 0 {
+		flags.Usage()
+		return fmt.Errorf("export needs one of -table or -query")
+	}
+	format, err := transferFormat(*formatName, *file)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	w := out
+	var f *os.File
+	if *file != "" {
+		if f, err = os.Create(*file); err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	var n int64
+	if *table != "" {
+		n, err = transfer.ExportTable(ctx, db, w, format, *table)
+	} else {
+		n, err = transfer.Export(ctx, db, w, format, *query)
+	}
+	if err != nil {
+		return err
+	}
+	if f != nil {
+		// a file that does not close was not written
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(errOut, "exported %d rows\n", n)
+	return nil
+}
+
+// runs the import subcommand, args are the ones after "import"
+func runImport(ctx context.Context, dsn string, args []string, out, errOut io.Writer) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	flags.Usage = func() { fmt.Fprint(errOut, importUsage) }
+	table := flags.String("table", "", "the table the rows are written to")
+	formatName := flags.String("format", "", "csv, or jsonl")
+	upsert := flags.Bool("upsert", false, "replace rows that already exist")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *table == "" || flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("import needs a -table, and at most one file")
+	}
+	in := io.Reader(os.Stdin)
+	file := flags.Arg(0)
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	format, err := transferFormat(*formatName, file)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("spanner", dsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	n, err := transfer.Import(ctx, conn, in, format, *table, &transfer.ImportOptions{Upsert: *upsert})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(errOut, "imported %d rows\n", n)
+	return nil
+}
+
+// the -format flag, or the format of the file's extension
+func transferFormat(name, file string) (transfer.Format, error) {
+	if name != "" {
+		return transfer.ParseFormat(name)
+	}
+	return transfer.FormatOf(file), nil
+}
@@ -0,0 +1,142 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+// spanner's result set metadata does not say if a column is nullable,
+// so every scalar column is scanned into the spanner.Null* type that
+// can hold both a NULL, and the plain value returned by valueConverter
+var scanTypes = map[v1.TypeCode]reflect.Type{
+	v1.TypeCode_BOOL:      reflect.TypeOf(spanner.NullBool{}),
+	v1.TypeCode_INT64:     reflect.TypeOf(spanner.NullInt64{}),
+	v1.TypeCode_FLOAT64:   reflect.TypeOf(spanner.NullFloat64{}),
+	v1.TypeCode_TIMESTAMP: reflect.TypeOf(spanner.NullTime{}),
+	v1.TypeCode_DATE:      reflect.TypeOf(spanner.NullDate{}),
+	v1.TypeCode_STRING:    reflect.TypeOf(spanner.NullString{}),
+	v1.TypeCode_BYTES:     reflect.TypeOf([]byte{}),
+	v1.TypeCode_NUMERIC:   reflect.TypeOf(spanner.NullNumeric{}),
+	v1.TypeCode_JSON:      reflect.TypeOf(spanner.NullJSON{}),
+	v1.TypeCode_STRUCT:    reflect.TypeOf(spanner.NullRow{}),
+}
+
+// in ResultModeStandard NULLs are returned as nil, so scalars are scanned into
+// the database/sql Null* types holding what StandardValue returns for them
+var standardScanTypes = map[v1.TypeCode]reflect.Type{
+	v1.TypeCode_BOOL:      reflect.TypeOf(sql.NullBool{}),
+	v1.TypeCode_INT64:     reflect.TypeOf(sql.NullInt64{}),
+	v1.TypeCode_FLOAT64:   reflect.TypeOf(sql.NullFloat64{}),
+	v1.TypeCode_TIMESTAMP: reflect.TypeOf(sql.NullTime{}),
+	v1.TypeCode_DATE:      reflect.TypeOf(sql.NullTime{}),
+	v1.TypeCode_STRING:    reflect.TypeOf(sql.NullString{}),
+	v1.TypeCode_BYTES:     reflect.TypeOf([]byte{}),
+	v1.TypeCode_NUMERIC:   reflect.TypeOf(sql.NullString{}),
+	v1.TypeCode_JSON:      reflect.TypeOf([]byte{}),
+	v1.TypeCode_STRUCT:    reflect.TypeOf([]interface{}{}),
+}
+
+var interfaceType = reflect.TypeOf((*interface{})(nil)).Elem()
+
+// the name of a spanner type as it would be written in a CREATE TABLE statement.
+// ex. INT64, ARRAY<STRING>, STRUCT<a INT64, b STRING>
+func databaseTypeName(t *v1.Type) string {
+	if t == nil {
+		return ""
+	}
+	switch t.Code {
+	case v1.TypeCode_ARRAY:
+		return fmt.Sprintf("ARRAY<%s>", databaseTypeName(t.ArrayElementType))
+	case v1.TypeCode_STRUCT:
+		fields := make([]string, len(t.GetStructType().GetFields()))
+		for i, f := range t.GetStructType().GetFields() {
+			fields[i] = strings.TrimSpace(f.Name + " " + databaseTypeName(f.Type))
+		}
+		return fmt.Sprintf("STRUCT<%s>", strings.Join(fields, ", "))
+	}
+	return t.Code.String()
+}
+
+// the go type that a column of type t can be scanned into in the given result
+// mode.  Arrays are scanned into the same slices valueConverter returns for them
+func scanType(t *v1.Type, mode ResultMode) reflect.Type {
+	if t == nil {
+		return interfaceType
+	}
+	if mode == ResultModeStandard {
+		if t.Code == v1.TypeCode_ARRAY {
+			return reflect.TypeOf([]interface{}{})
+		}
+		if st, ok := standardScanTypes[t.Code]; ok {
+			return st
+		}
+		return interfaceType
+	}
+	if t.Code == v1.TypeCode_ARRAY {
+		if t.ArrayElementType == nil {
+			return interfaceType
+		}
+		if t.ArrayElementType.Code == v1.TypeCode_BYTES {
+			return reflect.TypeOf([][]byte{})
+		}
+		elem, ok := scanTypes[t.ArrayElementType.Code]
+		if !ok {
+			return interfaceType
+		}
+		return reflect.SliceOf(elem)
+	}
+	if st, ok := scanTypes[t.Code]; ok {
+		return st
+	}
+	return interfaceType
+}
+
+// STRING, BYTES and arrays are variable length, spanner does not include their
+// max length in the result set metadata, so they are reported as unbounded
+func columnLength(t *v1.Type) (int64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	switch t.Code {
+	case v1.TypeCode_STRING, v1.TypeCode_BYTES, v1.TypeCode_ARRAY:
+		return math.MaxInt64, true
+	}
+	return 0, false
+}
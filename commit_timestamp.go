@@ -0,0 +1,77 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// spanner only recognizes the spanner.CommitTimestamp sentinel itself, a copy
+// that went through the type cache encoder loses its location and would be
+// written as the unix epoch
+func isCommitTimestamp(v interface{}) bool {
+	switch t := v.(type) {
+	case time.Time:
+		return t == spanner.CommitTimestamp
+	case spanner.NullTime:
+		return t.Valid && t.Time == spanner.CommitTimestamp
+	}
+	return false
+}
+
+func (c *conn) CommitTimestamp() (time.Time, error) {
+	if c.commitTimestamp != nil {
+		return *c.commitTimestamp, nil
+	}
+	return time.Time{}, fmt.Errorf("last exec did not commit")
+}
+
+// CommitTimestamp returns the time spanner committed the last exec run on c,
+// or the last transaction committed on c.
+// Write PENDING_COMMIT_TIMESTAMP(), or pass spanner.CommitTimestamp as an arg,
+// to store the same time in a column with allow_commit_timestamp=true
+func CommitTimestamp(c *sql.Conn) (time.Time, error) {
+	var ts time.Time
+	err := c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a spanner connection: %T", driverConn)
+		}
+		var err error
+		ts, err = sc.CommitTimestamp()
+		return err
+	})
+	return ts, err
+}
@@ -0,0 +1,83 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"github.com/xwb1989/sqlparser"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Commit timestamps", func() {
+	Describe("PENDING_COMMIT_TIMESTAMP()", func() {
+		It("is parsed as the commit timestamp sentinel", func() {
+			args := &sqlspanner.Args{}
+			val, err := args.ParseValExpr(&sqlparser.FuncExpr{Name: []byte("PENDING_COMMIT_TIMESTAMP")})
+			Expect(err).To(BeNil())
+			Expect(val).To(Equal(spanner.CommitTimestamp))
+			Expect(sqlspanner.IsCommitTimestamp(val)).To(BeTrue())
+		})
+
+		It("ignores case", func() {
+			args := &sqlspanner.Args{}
+			val, err := args.ParseValExpr(&sqlparser.FuncExpr{Name: []byte("pending_commit_timestamp")})
+			Expect(err).To(BeNil())
+			Expect(sqlspanner.IsCommitTimestamp(val)).To(BeTrue())
+		})
+
+		It("does not take arguments", func() {
+			args := &sqlspanner.Args{}
+			_, err := args.ParseValExpr(&sqlparser.FuncExpr{
+				Name:  []byte("PENDING_COMMIT_TIMESTAMP"),
+				Exprs: sqlparser.SelectExprs{&sqlparser.StarExpr{}},
+			})
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	Describe("detecting the sentinel", func() {
+		It("accepts the sentinel as a time, or a valid NullTime", func() {
+			Expect(sqlspanner.IsCommitTimestamp(spanner.CommitTimestamp)).To(BeTrue())
+			Expect(sqlspanner.IsCommitTimestamp(spanner.NullTime{Time: spanner.CommitTimestamp, Valid: true})).To(BeTrue())
+		})
+
+		It("rejects other times", func() {
+			Expect(sqlspanner.IsCommitTimestamp(time.Unix(0, 0))).To(BeFalse())
+			Expect(sqlspanner.IsCommitTimestamp(spanner.NullTime{Time: spanner.CommitTimestamp})).To(BeFalse())
+			Expect(sqlspanner.IsCommitTimestamp("spanner.commit_timestamp()")).To(BeFalse())
+		})
+	})
+})
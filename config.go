@@ -0,0 +1,179 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ResultMode controls which go types rows return for spanner values
+type ResultMode int
+
+const (
+	// ResultModeSpanner returns plain go values for non NULL scalars, and
+	// spanner.Null* values for NULLs and array elements. This is the default
+	ResultModeSpanner ResultMode = iota
+	// ResultModeStandard returns only standard driver.Value types, with nil for NULL.
+	// DATEs are returned as a time.Time at midnight UTC, NUMERICs as strings,
+	// JSON as []byte, and arrays as a []interface{} of standard values.
+	// Use Array, or one of the typed helpers like StringArray, to scan arrays
+	ResultModeStandard
+)
+
+// AutocommitDMLMode controls how UPDATE and DELETE statements run outside of a batch
+type AutocommitDMLMode int
+
+const (
+	// AutocommitDMLModeTransactional applies each statement atomically as a mutation.
+	// This is the default
+	AutocommitDMLModeTransactional AutocommitDMLMode = iota
+	// AutocommitDMLModePartitionedNonAtomic runs UPDATE and DELETE statements with
+	// spanner's PartitionedUpdate. Statements may touch any number of rows and do not
+	// need a WHERE clause on the primary key, but are not applied atomically.
+	// RowsAffected is a lower bound of the rows changed
+	AutocommitDMLModePartitionedNonAtomic
+)
+
+func (m AutocommitDMLMode) String() string {
+	switch m {
+	case AutocommitDMLModeTransactional:
+		return "TRANSACTIONAL"
+	case AutocommitDMLModePartitionedNonAtomic:
+		return "PARTITIONED_NON_ATOMIC"
+	}
+	return fmt.Sprintf("AutocommitDMLMode(%d)", int(m))
+}
+
+func parseAutocommitDMLMode(s string) (AutocommitDMLMode, error) {
+	switch strings.ToUpper(s) {
+	case "TRANSACTIONAL", "":
+		return AutocommitDMLModeTransactional, nil
+	case "PARTITIONED_NON_ATOMIC":
+		return AutocommitDMLModePartitionedNonAtomic, nil
+	}
+	return 0, fmt.Errorf("unknown autocommit dml mode %q", s)
+}
+
+// Config holds the settings of a connection. It is parsed from a data source name like:
+//   projects/my-project/instances/my-instance/databases/my-db?resultMode=standard
+type Config struct {
+	// the spanner database path: projects/P/instances/I/databases/D
+	Database   string
+	ResultMode ResultMode
+	// run every query in PROFILE mode, so its statistics are available from LastQueryStats
+	QueryStats bool
+	// the dml mode connections start with, it can be changed with SET AUTOCOMMIT_DML_MODE
+	AutocommitDMLMode AutocommitDMLMode
+	// reject INSERT, UPDATE, DELETE, DDL, and mutations with a *ReadOnlyError. Queries
+	// always run in read only single use transactions
+	ReadOnly bool
+	// run UPDATE and DELETE statements without a WHERE clause in PARTITIONED_NON_ATOMIC
+	// mode, and DELETEs of key ranges that are not bounded on both ends. They are
+	// rejected with an *UnboundedWriteError by default
+	AllowUnboundedWrites bool
+	// the dry run mode connections start with, see SpannerConn.SetDryRun
+	DryRun bool
+}
+
+// ParseDSN parses a data source name into a Config. Options are given as url
+// query parameters after the database path. Supported options are:
+//   resultMode: "spanner" (default), or "standard"
+//   queryStats: "true" to collect execution statistics for every query
+//   autocommitDMLMode: "TRANSACTIONAL" (default), or "PARTITIONED_NON_ATOMIC"
+//   readOnly: "true" to reject writes
+//   allowUnboundedWrites: "true" to run writes that may change a whole table
+//   dryRun: "true" to build writes without sending them to spanner
+func ParseDSN(dsn string) (*Config, error) {
+	cfg := &Config{}
+	path, query := dsn, ""
+	if i := strings.Index(dsn, "?"); i >= 0 {
+		path, query = dsn[:i], dsn[i+1:]
+	}
+	if path == "" {
+		return nil, fmt.Errorf("data source name must include a database path")
+	}
+	cfg.Database = path
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data source name options %q: %v", query, err)
+	}
+	for key, vals := range params {
+		val := vals[len(vals)-1]
+		switch key {
+		case "resultMode":
+			switch strings.ToLower(val) {
+			case "spanner", "":
+				cfg.ResultMode = ResultModeSpanner
+			case "standard":
+				cfg.ResultMode = ResultModeStandard
+			default:
+				return nil, fmt.Errorf("unknown resultMode %q", val)
+			}
+		case "queryStats":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid queryStats %q: %v", val, err)
+			}
+			cfg.QueryStats = b
+		case "autocommitDMLMode":
+			mode, err := parseAutocommitDMLMode(val)
+			if err != nil {
+				return nil, err
+			}
+			cfg.AutocommitDMLMode = mode
+		case "readOnly":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid readOnly %q: %v", val, err)
+			}
+			cfg.ReadOnly = b
+		case "allowUnboundedWrites":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allowUnboundedWrites %q: %v", val, err)
+			}
+			cfg.AllowUnboundedWrites = b
+		case "dryRun":
+			b, err := strconv.ParseBool(val)
+			if err != nil {
+				return nil, fmt.Errorf("invalid dryRun %q: %v", val, err)
+			}
+			cfg.DryRun = b
+		default:
+			return nil, fmt.Errorf("unknown data source name option %q", key)
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,138 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Config", func() {
+	Describe("parsing a data source name", func() {
+		It("uses the whole name as the database path when there are no options", func() {
+			cfg, err := sqlspanner.ParseDSN("projects/p/instances/i/databases/d")
+			Expect(err).To(BeNil())
+			Expect(cfg.Database).To(Equal("projects/p/instances/i/databases/d"))
+			Expect(cfg.ResultMode).To(Equal(sqlspanner.ResultModeSpanner))
+		})
+
+		It("parses the result mode", func() {
+			cfg, err := sqlspanner.ParseDSN("projects/p/instances/i/databases/d?resultMode=standard")
+			Expect(err).To(BeNil())
+			Expect(cfg.Database).To(Equal("projects/p/instances/i/databases/d"))
+			Expect(cfg.ResultMode).To(Equal(sqlspanner.ResultModeStandard))
+		})
+
+		It("parses the autocommit dml mode", func() {
+			cfg, err := sqlspanner.ParseDSN("projects/p/instances/i/databases/d?autocommitDMLMode=PARTITIONED_NON_ATOMIC")
+			Expect(err).To(BeNil())
+			Expect(cfg.AutocommitDMLMode).To(Equal(sqlspanner.AutocommitDMLModePartitionedNonAtomic))
+			_, err = sqlspanner.ParseDSN("projects/p/instances/i/databases/d?autocommitDMLMode=sometimes")
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("parses the write guards", func() {
+			cfg, err := sqlspanner.ParseDSN("projects/p/instances/i/databases/d?readOnly=true&allowUnboundedWrites=1")
+			Expect(err).To(BeNil())
+			Expect(cfg.ReadOnly).To(BeTrue())
+			Expect(cfg.AllowUnboundedWrites).To(BeTrue())
+			_, err = sqlspanner.ParseDSN("projects/p/instances/i/databases/d?readOnly=maybe")
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("parses dry run mode", func() {
+			cfg, err := sqlspanner.ParseDSN("projects/p/instances/i/databases/d?dryRun=true")
+			Expect(err).To(BeNil())
+			Expect(cfg.DryRun).To(BeTrue())
+		})
+
+		It("rejects unknown options", func() {
+			_, err := sqlspanner.ParseDSN("projects/p/instances/i/databases/d?nope=1")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+})
+
+var _ = Describe("Write guards", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("rejects DDL on read only connections", func() {
+		c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{ReadOnly: true})
+		st, err := c.Prepare("CREATE TABLE t (id INT64) PRIMARY KEY (id)")
+		Expect(err).To(BeNil())
+		_, err = st.Exec(nil)
+		var roErr *sqlspanner.ReadOnlyError
+		Expect(errors.As(err, &roErr)).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(roErr.Statement).To(Equal("DDL"))
+	})
+
+	It("rejects mutations on read only connections", func() {
+		c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{ReadOnly: true})
+		err := c.WriteMutations(ctx, spanner.Delete("t", spanner.Key{1}))
+		var roErr *sqlspanner.ReadOnlyError
+		Expect(errors.As(err, &roErr)).To(BeTrue(), fmt.Sprintf("%T", err))
+	})
+
+	It("still allows session settings on read only connections", func() {
+		c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{ReadOnly: true})
+		st, err := c.Prepare("SET AUTOCOMMIT_DML_MODE = 'PARTITIONED_NON_ATOMIC'")
+		Expect(err).To(BeNil())
+		_, err = st.Exec(nil)
+		Expect(err).To(BeNil())
+	})
+
+	It("knows which delete key ranges are bounded", func() {
+		_, bounded, err := sqlspanner.PackKeySet(&sqlspanner.Key{Name: "id", LowerValue: int64(1), UpperValue: int64(1), HaveLower: true, HaveUpper: true})
+		Expect(err).To(BeNil())
+		Expect(bounded).To(BeTrue())
+		_, bounded, err = sqlspanner.PackKeySet(&sqlspanner.Key{Name: "id", LowerValue: int64(1), HaveLower: true, LowerOpen: true})
+		Expect(err).To(BeNil())
+		Expect(bounded).To(BeFalse())
+		_, bounded, err = sqlspanner.PackKeySet(
+			&sqlspanner.Key{Name: "id", LowerValue: int64(1), UpperValue: int64(9), HaveLower: true, HaveUpper: true},
+			&sqlspanner.Key{Name: "sub", UpperValue: "b", HaveUpper: true},
+		)
+		Expect(err).To(BeNil())
+		Expect(bounded).To(BeTrue())
+	})
+})
@@ -32,46 +32,185 @@ package sqlspanner
 
 import (
 	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
 	"context"
 	"database/sql/driver"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/codes"
 )
 
+// SpannerConn exposes spanner specific features of the driver's connections.
+// Get to it with sql.Conn.Raw:
+//   err := conn.Raw(func(c interface{}) error {
+//   	stats := c.(sqlspanner.SpannerConn).LastQueryStats()
+//   	...
+//   })
+type SpannerConn interface {
+	// LastQueryStats returns the execution statistics of the last query run on
+	// the connection, or nil if the query did not collect statistics
+	LastQueryStats() map[string]interface{}
+	// StartBatchDDL queues DDL statements executed on the connection until RunBatch,
+	// the same as executing START BATCH DDL
+	StartBatchDDL() error
+	// StartBatchDML queues INSERT, UPDATE, and DELETE statements executed on the connection
+	// until RunBatch, the same as executing START BATCH DML
+	StartBatchDML() error
+	// RunBatch sends the queued statements to spanner in a single request. For a DML
+	// batch it returns the number of rows affected by each statement
+	RunBatch(ctx context.Context) ([]int64, error)
+	// AbortBatch discards the queued statements
+	AbortBatch() error
+	// AutocommitDMLMode returns how UPDATE and DELETE statements are run on the connection
+	AutocommitDMLMode() AutocommitDMLMode
+	// SetAutocommitDMLMode changes how UPDATE and DELETE statements are run on the
+	// connection, the same as executing SET AUTOCOMMIT_DML_MODE = '<mode>'
+	SetAutocommitDMLMode(mode AutocommitDMLMode) error
+	// CommitTimestamp returns the time spanner committed the last exec or transaction
+	// on the connection, or an error if it did not commit anything
+	CommitTimestamp() (time.Time, error)
+	// WriteMutations buffers the mutations in the connection's transaction, to be
+	// applied when it commits. Outside of a transaction they are applied immediately
+	WriteMutations(ctx context.Context, muts ...*spanner.Mutation) error
+	// DryRun reports if the connection is in dry run mode
+	DryRun() bool
+	// SetDryRun turns dry run mode on or off. In dry run mode execs build their
+	// mutations, DML, and DDL as usual, but do not send them to spanner. Writes
+	// in a transaction are not buffered, and the commit does nothing
+	SetDryRun(dryRun bool)
+	// PlannedWrites returns the writes the last exec built in dry run mode
+	PlannedWrites() []*PlannedWrite
+	// Client returns the spanner client the connection runs its statements with
+	Client() *spanner.Client
+	// HasInformationSchema reports whether the database has an INFORMATION_SCHEMA,
+	// the fake package's databases do not
+	HasInformationSchema() bool
+}
+
 type conn struct {
-	ctx    context.Context
-	client *spanner.Client
+	ctx      context.Context
+	client   *spanner.Client
+	admin    *database.DatabaseAdminClient
+	cfg      *Config
+	lastRows *rows
+	batch    *batch // set between START BATCH, and RUN BATCH or ABORT BATCH
+	dmlMode  AutocommitDMLMode
+	tx       *tx // the running transaction
+	// index and primary key columns by table@index, for point lookups
+	indexes map[string]*indexColumns
+	// set when the database has no information schema to look indexes up in, like the fake
+	noInformationSchema bool
+	// the commit time of the last exec, nil when it did not commit
+	commitTimestamp *time.Time
+	// set once the connection is closed, or spanner rejected its credentials
+	bad bool
+	dryRun bool
+	// guards planned, a bulk loader plans its batches concurrently
+	plannedMu sync.Mutex
+	// the writes the last exec built in dry run mode
+	planned []*PlannedWrite
+}
+
+func (c *conn) Client() *spanner.Client {
+	return c.client
 }
 
 func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
 	return newStmt(query, c)
 }
 
 func (c *conn) Close() error {
+	c.bad = true
 	if c.client != nil {
 		c.client.Close()
 	}
+	if c.admin != nil {
+		return c.admin.Close()
+	}
 	return nil
 }
 
 func (c *conn) Begin() (driver.Tx, error) {
-	return newTransaction(context.Background(), c, nil)
+	return c.BeginTx(context.Background(), driver.TxOptions{})
 }
 
 func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if c.bad {
+		return nil, driver.ErrBadConn
+	}
 	return newTransaction(ctx, c, &opts)
 }
 
+// Ping only reports driver.ErrBadConn when the connection cannot be used anymore,
+// spanner being unavailable, or ctx being done, are returned as they are
 func (c *conn) Ping(ctx context.Context) error {
+	if c.bad {
+		return driver.ErrBadConn
+	}
 	stmt := spanner.Statement{SQL: "SELECT 1"}
-	iter := c.client.Single().Query(c.ctx, stmt)
+	iter := c.client.Single().Query(ctx, stmt)
 	defer iter.Stop()
-	row, err := iter.Next()
-	if err != nil {
+	_, err := iter.Next()
+	if err == nil {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if isBadConn(err) {
+		c.bad = true
 		return driver.ErrBadConn
 	}
+	return spannerError(err)
+}
+
+// implements driver.Validator, database/sql drops connections that are not valid
+// instead of putting them back in the pool
+func (c *conn) IsValid() bool {
+	return !c.bad
+}
 
-	var i int64
-	if row.Columns(&i) != nil {
+// implements driver.SessionResetter. database/sql calls it before a pooled connection
+// is used again, so a batch or dml mode left by the last user does not change the
+// statements of the next one
+func (c *conn) ResetSession(ctx context.Context) error {
+	if c.bad {
 		return driver.ErrBadConn
 	}
+	c.batch = nil
+	c.dmlMode = c.cfg.AutocommitDMLMode
+	c.dryRun = c.cfg.DryRun
 	return nil
 }
+
+// spanner rejects every request of a client whose credentials are no longer
+// valid, like after they are rotated. The client does not recover from it
+func isBadConn(err error) bool {
+	return ErrorCode(err) == codes.Unauthenticated
+}
+
+// marks the connection bad when err means it cannot be used anymore. database/sql
+// retries driver.ErrBadConn on another connection, so it is only returned when spanner
+// did not run the request, and no transaction or batch is lost with the connection
+func (c *conn) checkBadConn(err error) error {
+	if !isBadConn(err) {
+		return err
+	}
+	c.bad = true
+	if c.tx != nil || c.batch != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", driver.ErrBadConn, err)
+}
+
+func (c *conn) LastQueryStats() map[string]interface{} {
+	if c.lastRows == nil {
+		return nil
+	}
+	return c.lastRows.queryStats()
+}
@@ -31,10 +31,15 @@
 package sqlspanner_test
 
 import (
-	_ "github.com/tcncloud/sqlspanner"
+	"github.com/tcncloud/sqlspanner"
 
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -181,3 +186,57 @@ var _ = Describe("Conn", func() {
 		})
 	})
 })
+
+var _ = Describe("Conn health", func() {
+	unauthenticated := status.Error(codes.Unauthenticated, "invalid credentials")
+
+	It("is not valid once it is closed", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		Expect(c.IsValid()).To(BeTrue())
+		st, err := c.Prepare("START BATCH DML")
+		Expect(err).To(BeNil())
+		Expect(c.Close()).To(BeNil())
+		Expect(c.IsValid()).To(BeFalse())
+		_, err = st.Exec(nil)
+		Expect(err).To(Equal(driver.ErrBadConn))
+		_, err = c.Prepare("START BATCH DML")
+		Expect(err).To(Equal(driver.ErrBadConn))
+		Expect(c.Ping(context.Background())).To(Equal(driver.ErrBadConn))
+		Expect(c.ResetSession(context.Background())).To(Equal(driver.ErrBadConn))
+	})
+
+	It("signals a bad connection when spanner rejects its credentials", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		err := sqlspanner.CheckBadConn(c, unauthenticated)
+		Expect(errors.Is(err, driver.ErrBadConn)).To(BeTrue())
+		Expect(sqlspanner.ErrorCode(err)).To(Equal(codes.Unauthenticated))
+		Expect(c.IsValid()).To(BeFalse())
+	})
+
+	It("does not signal a bad connection for other errors", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		err := status.Error(codes.Unavailable, "unavailable")
+		Expect(sqlspanner.CheckBadConn(c, err)).To(Equal(err))
+		Expect(sqlspanner.CheckBadConn(c, nil)).To(BeNil())
+		Expect(c.IsValid()).To(BeTrue())
+	})
+
+	It("does not signal a bad connection when a transaction would be lost", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		_, err := c.BeginTx(context.Background(), driver.TxOptions{})
+		Expect(err).To(BeNil())
+		err = sqlspanner.CheckBadConn(c, unauthenticated)
+		Expect(errors.Is(err, driver.ErrBadConn)).To(BeFalse())
+		Expect(c.IsValid()).To(BeFalse())
+	})
+
+	It("resets the session state a pooled connection was left with", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		Expect(c.StartBatchDML()).To(BeNil())
+		Expect(c.SetAutocommitDMLMode(sqlspanner.AutocommitDMLModePartitionedNonAtomic)).To(BeNil())
+		Expect(c.ResetSession(context.Background())).To(BeNil())
+		Expect(c.AutocommitDMLMode()).To(Equal(sqlspanner.AutocommitDMLModeTransactional))
+		// the batch was dropped, so another one can start
+		Expect(c.StartBatchDML()).To(BeNil())
+	})
+})
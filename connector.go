@@ -0,0 +1,94 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+
+	"cloud.google.com/go/spanner"
+)
+
+// Connector opens connections to the database of a Config. Use it with sql.OpenDB
+// to reach the features that are not tied to a single connection, like partitioned queries:
+//   connector, err := sqlspanner.NewConnector("projects/p/instances/i/databases/d")
+//   db := sql.OpenDB(connector)
+type Connector struct {
+	cfg *Config
+
+	mu     sync.Mutex
+	client *spanner.Client // for the connector's own requests, connections have their own clients
+}
+
+func NewConnector(dsn string) (*Connector, error) {
+	cfg, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &Connector{cfg: cfg}, nil
+}
+
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	return openConn(ctx, c.cfg)
+}
+
+func (c *Connector) Driver() driver.Driver {
+	return &drv{}
+}
+
+func (c *Connector) spannerClient(ctx context.Context) (*spanner.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client == nil {
+		ep, err := endpoint(c.cfg)
+		if err != nil {
+			return nil, err
+		}
+		client, err := spanner.NewClient(ctx, ep.Database, ep.Options...)
+		if err != nil {
+			return nil, err
+		}
+		c.client = client
+	}
+	return c.client, nil
+}
+
+// Close releases the connector's client, sql.DB calls it when the db is closed
+func (c *Connector) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		c.client.Close()
+		c.client = nil
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+
+	"cloud.google.com/go/spanner"
+	database "cloud.google.com/go/spanner/admin/database/apiv1"
+	adminpb "google.golang.org/genproto/googleapis/spanner/admin/database/v1"
+)
+
+// spanner's DDL is not something sqlparser understands, so DDL statements
+// are recognized by their leading keywords, and sent to spanner as is
+var ddlRegexp = regexp.MustCompile(`(?is)^\s*(` +
+	`CREATE\s+(OR\s+REPLACE\s+)?(` + ddlObjects + `|ROLE|(UNIQUE\s+)?(NULL_FILTERED\s+)?INDEX|PLACEMENT)` +
+	`|ALTER\s+(DATABASE|INDEX|` + ddlObjects + `)` +
+	`|DROP\s+(ROLE|INDEX|` + ddlObjects + `)` +
+	`|GRANT|REVOKE|ANALYZE|RENAME\s+TABLE` +
+	`)(\s|;|$)`)
+
+// the objects that can be created, altered, and dropped
+const ddlObjects = `TABLE|(SEARCH\s+|VECTOR\s+)INDEX|VIEW|CHANGE\s+STREAM|SEQUENCE|MODEL|SCHEMA|PROTO\s+BUNDLE|LOCALITY\s+GROUP`
+
+// IsDDL reports whether the driver runs query as a schema change: a CREATE, ALTER,
+// or DROP of a table, index, view, change stream, or another schema object, ALTER
+// DATABASE, GRANT, REVOKE, ANALYZE, or RENAME TABLE. Comments in front of the
+// statement are skipped
+func IsDDL(query string) bool {
+	return ddlRegexp.MatchString(query[leadingComments(query):])
+}
+
+// runs ddl as a single schema change, or queues it if a DDL batch is running
+func (c *conn) queueOrExecDDL(ctx context.Context, ddl string) (driver.Result, error) {
+	rowsAffected := int64(0)
+	res := &result{rowsAffected: &rowsAffected}
+	if c.tx != nil {
+		return nil, fmt.Errorf("cannot run DDL statements in a transaction")
+	}
+	if c.batch != nil {
+		if c.batch.kind != batchKindDDL {
+			return nil, fmt.Errorf("cannot run DDL statements in a DML batch")
+		}
+		c.batch.ddl = append(c.batch.ddl, ddl)
+		return res, nil
+	}
+	if c.planWrites(&PlannedWrite{Op: "DDL", Statement: &spanner.Statement{SQL: ddl}}) {
+		return res, nil
+	}
+	return res, c.execDDL(ctx, []string{ddl})
+}
+
+// sends statements to spanner as one schema change, and waits for it to finish
+func (c *conn) execDDL(ctx context.Context, statements []string) error {
+	admin, err := c.adminClient(ctx)
+	if err != nil {
+		return err
+	}
+	ep, err := endpoint(c.cfg)
+	if err != nil {
+		return err
+	}
+	op, err := admin.UpdateDatabaseDdl(ctx, &adminpb.UpdateDatabaseDdlRequest{
+		Database:   ep.Database,
+		Statements: statements,
+	})
+	if err != nil {
+		return spannerError(err)
+	}
+	if err := op.Wait(ctx); err != nil {
+		return spannerError(err)
+	}
+	// the change may have added, dropped, or altered the cached indexes
+	c.indexes = nil
+	return nil
+}
+
+// the admin client is only created the first time a connection runs DDL
+func (c *conn) adminClient(ctx context.Context) (*database.DatabaseAdminClient, error) {
+	if c.admin == nil {
+		ep, err := endpoint(c.cfg)
+		if err != nil {
+			return nil, err
+		}
+		admin, err := database.NewDatabaseAdminClient(ctx, ep.Options...)
+		if err != nil {
+			return nil, err
+		}
+		c.admin = admin
+	}
+	return c.admin, nil
+}
@@ -0,0 +1,84 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner_test
+
+import (
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DDL", func() {
+	Describe("detecting DDL statements", func() {
+		It("recognizes spanner DDL", func() {
+			for _, q := range []string{
+				"CREATE TABLE t (id INT64 NOT NULL) PRIMARY KEY (id)",
+				"create unique null_filtered index idx ON t (a)",
+				"CREATE NULL_FILTERED INDEX idx ON t (a)",
+				"CREATE INDEX idx ON t (a DESC)",
+				"\n  ALTER TABLE t ADD COLUMN b STRING(MAX)",
+				"DROP TABLE t",
+				"drop index idx",
+				"CREATE CHANGE STREAM users_stream FOR users",
+				"CREATE OR REPLACE VIEW v SQL SECURITY INVOKER AS SELECT id FROM t",
+				"ALTER DATABASE db SET OPTIONS (version_retention_period = '7d')",
+				"CREATE SEQUENCE seq OPTIONS (sequence_kind = 'bit_reversed_positive')",
+				"DROP CHANGE STREAM users_stream",
+				"CREATE SEARCH INDEX idx ON t (tokens)",
+				"CREATE ROLE reader",
+				"GRANT SELECT ON TABLE t TO ROLE reader",
+				"REVOKE SELECT ON TABLE t FROM ROLE reader",
+				"ANALYZE",
+				"-- users\nCREATE TABLE t (id INT64 NOT NULL) PRIMARY KEY (id)",
+				"/* v2 */ ALTER TABLE t ADD COLUMN b STRING(MAX)",
+				"# old\n/* unused */\nDROP TABLE t",
+			} {
+				Expect(sqlspanner.IsDDL(q)).To(BeTrue(), q)
+			}
+		})
+
+		It("does not mistake other statements for DDL", func() {
+			for _, q := range []string{
+				"SELECT * FROM create_table",
+				"INSERT INTO t (id) VALUES (1)",
+				"DELETE FROM drop_index WHERE id = 1",
+				"SELECT * FROM grants",
+				"UPDATE analyze SET a = 1 WHERE id = 1",
+				"-- CREATE TABLE t\nSELECT 1",
+				"/* DROP TABLE t */",
+			} {
+				Expect(sqlspanner.IsDDL(q)).To(BeFalse(), q)
+			}
+		})
+	})
+})
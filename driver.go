@@ -35,16 +35,14 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
+	"math/big"
+	"reflect"
 
-	"github.com/Sirupsen/logrus"
 	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 )
 
-func init() {
-	logrus.SetLevel(logrus.DebugLevel)
-}
-
 type drv struct{}
 
 func init() {
@@ -52,19 +50,41 @@ func init() {
 }
 
 func (d *drv) Open(name string) (driver.Conn, error) {
-	logrus.WithField("spanner db path", name).Debug("database connection")
-	ctx := context.Background()
-	client, err := spanner.NewClient(ctx, name)
+	cfg, err := ParseDSN(name)
+	if err != nil {
+		return nil, err
+	}
+	return openConn(context.Background(), cfg)
+}
+
+func (d *drv) OpenConnector(name string) (driver.Connector, error) {
+	return NewConnector(name)
+}
+
+func openConn(ctx context.Context, cfg *Config) (*conn, error) {
+	ep, err := endpoint(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client, err := spanner.NewClient(ctx, ep.Database, ep.Options...)
 	if err != nil {
 		return nil, err
 	}
 	return &conn{
-		ctx:    ctx,
-		client: client,
+		ctx:                 context.Background(),
+		client:              client,
+		cfg:                 cfg,
+		dmlMode:             cfg.AutocommitDMLMode,
+		dryRun:              cfg.DryRun,
+		noInformationSchema: ep.NoInformationSchema,
 	}, nil
 }
 
 func IsValue(v interface{}) bool {
+	return isSpannerValue(v) || isJSONValue(v)
+}
+
+func isSpannerValue(v interface{}) bool {
 	switch v.(type){
 	case int, int64, spanner.NullInt64:
 		return true
@@ -76,6 +96,8 @@ func IsValue(v interface{}) bool {
 		return true
 	case bool, spanner.NullBool:
 		return true
+	case []bool, []spanner.NullBool:
+		return true
 	case float64, spanner.NullFloat64:
 		return true
 	case []float64, []spanner.NullFloat64:
@@ -86,12 +108,75 @@ func IsValue(v interface{}) bool {
 		return true
 	case civil.Date, []civil.Date:
 		return true
+	case spanner.NullDate, []spanner.NullDate:
+		return true
+	case *big.Rat, big.Rat, spanner.NullNumeric:
+		return true
+	case []*big.Rat, []big.Rat, []spanner.NullNumeric:
+		return true
+	case json.RawMessage, spanner.NullJSON, []spanner.NullJSON:
+		return true
+	case []byte, [][]byte:
+		return true
 	case nil:
 		return true
 	}
 	return false
 }
 
+// anything that is not a known spanner type, but can be marshaled
+// is allowed to be written to a JSON column
+func isJSONValue(v interface{}) bool {
+	if _, ok := v.(json.Marshaler); ok {
+		return true
+	}
+	switch reflect.ValueOf(v).Kind() {
+	case reflect.Map, reflect.Struct:
+		return true
+	}
+	return false
+}
+
+// JSON values are normalized to a spanner.NullJSON holding the marshaled json,
+// so spanner encodes them as JSON, and they can be gob encoded by the typeCacheEncoder.
+// all other values are returned as is.
+func toJSONValue(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case json.RawMessage:
+		return spanner.NullJSON{Value: t, Valid: t != nil}, nil
+	case spanner.NullJSON:
+		if !t.Valid {
+			return spanner.NullJSON{}, nil
+		}
+		b, err := json.Marshal(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return spanner.NullJSON{Value: json.RawMessage(b), Valid: true}, nil
+	case []spanner.NullJSON:
+		if t == nil {
+			return t, nil
+		}
+		vals := make([]spanner.NullJSON, len(t))
+		for i, nj := range t {
+			val, err := toJSONValue(nj)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val.(spanner.NullJSON)
+		}
+		return vals, nil
+	}
+	if isSpannerValue(v) || !isJSONValue(v) {
+		return v, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return spanner.NullJSON{Value: json.RawMessage(b), Valid: true}, nil
+}
+
 func needsEncoding(v interface{}) bool {
 	switch v.(type) {
 	case int, []string, []int, []int64, []bool, []float64, []time.Time:
@@ -102,6 +187,15 @@ func needsEncoding(v interface{}) bool {
 		return true
 	case []spanner.NullFloat64, []spanner.NullBool:
 		return true
+	case spanner.NullTime, spanner.NullBool, spanner.NullDate, []spanner.NullDate:
+		return true
+	case *big.Rat, big.Rat, spanner.NullNumeric, []*big.Rat, []big.Rat, []spanner.NullNumeric:
+		return true
+	case spanner.NullJSON, []spanner.NullJSON:
+		return true
+	// raw bytes are encoded too, so they are never mistaken for an encoded value
+	case []byte, [][]byte:
+		return true
 	}
 	return false
 }
@@ -0,0 +1,143 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+)
+
+// PlannedWrite is a write a dry run connection built, but did not send to spanner
+type PlannedWrite struct {
+	// INSERT, UPDATE, DELETE, MUTATION, PARTITIONED DML, DML, or DDL
+	Op      string
+	Table   string
+	Columns []string
+	Values  []interface{}
+	// the key or key range a DELETE removes
+	Keys spanner.KeySet
+	// set for INSERT, UPDATE, DELETE, and MUTATION writes
+	Mutation *spanner.Mutation
+	// set for statements that are sent to spanner as sql
+	Statement *spanner.Statement
+}
+
+// describes the write, like: DELETE users KEYS [(1),(5))
+func (w *PlannedWrite) String() string {
+	switch w.Op {
+	case "INSERT", "UPDATE":
+		vals := make([]string, len(w.Values))
+		for i, v := range w.Values {
+			vals[i] = formatPlannedValue(v)
+		}
+		return fmt.Sprintf("%s %s (%s) VALUES (%s)", w.Op, w.Table, strings.Join(w.Columns, ", "), strings.Join(vals, ", "))
+	case "DELETE":
+		return fmt.Sprintf("DELETE %s KEYS %v", w.Table, w.Keys)
+	case "MUTATION":
+		return fmt.Sprintf("MUTATION %+v", *w.Mutation)
+	}
+	if w.Statement == nil {
+		return w.Op
+	}
+	if len(w.Statement.Params) == 0 {
+		return fmt.Sprintf("%s %s", w.Op, w.Statement.SQL)
+	}
+	names := make([]string, 0, len(w.Statement.Params))
+	for name := range w.Statement.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = fmt.Sprintf("@%s=%s", name, formatPlannedValue(w.Statement.Params[name]))
+	}
+	return fmt.Sprintf("%s %s [%s]", w.Op, w.Statement.SQL, strings.Join(params, ", "))
+}
+
+func formatPlannedValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func (c *conn) DryRun() bool {
+	return c.dryRun
+}
+
+func (c *conn) SetDryRun(dryRun bool) {
+	c.dryRun = dryRun
+}
+
+func (c *conn) PlannedWrites() []*PlannedWrite {
+	c.plannedMu.Lock()
+	defer c.plannedMu.Unlock()
+	return c.planned
+}
+
+// records the writes when the connection is in dry run mode. When it returns
+// false the writes have to be sent to spanner
+func (c *conn) planWrites(writes ...*PlannedWrite) bool {
+	if !c.dryRun {
+		return false
+	}
+	c.plannedMu.Lock()
+	defer c.plannedMu.Unlock()
+	c.planned = append(c.planned, writes...)
+	return true
+}
+
+// PlannedWrites returns the writes the last exec on c would have made, when c
+// is in dry run mode. Turn it on with the dryRun data source name option, or
+// SpannerConn.SetDryRun:
+//   writes, err := sqlspanner.PlannedWrites(conn)
+//   for _, w := range writes {
+//   	fmt.Println(w)
+//   }
+func PlannedWrites(c *sql.Conn) ([]*PlannedWrite, error) {
+	var writes []*PlannedWrite
+	err := c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a spanner connection: %T", driverConn)
+		}
+		if !sc.DryRun() {
+			return fmt.Errorf("the connection is not in dry run mode")
+		}
+		writes = sc.PlannedWrites()
+		return nil
+	})
+	return writes, err
+}
@@ -0,0 +1,109 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"context"
+	"database/sql/driver"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type plannedResult interface {
+	PlannedWrites() []*sqlspanner.PlannedWrite
+}
+
+var _ = Describe("Dry run", func() {
+	exec := func(c driver.Conn, query string) (driver.Result, error) {
+		st, err := c.Prepare(query)
+		Expect(err).To(BeNil())
+		return st.Exec(nil)
+	}
+
+	It("describes planned writes", func() {
+		insert := &sqlspanner.PlannedWrite{Op: "INSERT", Table: "users", Columns: []string{"id", "name"}, Values: []interface{}{int64(1), "a"}}
+		Expect(insert.String()).To(Equal(`INSERT users (id, name) VALUES (1, "a")`))
+		del := &sqlspanner.PlannedWrite{Op: "DELETE", Table: "users", Keys: spanner.KeyRange{Start: spanner.Key{1}, End: spanner.Key{5}, Kind: spanner.ClosedOpen}}
+		Expect(del.String()).To(Equal("DELETE users KEYS [(1),(5))"))
+		dml := &sqlspanner.PlannedWrite{Op: "PARTITIONED DML", Statement: &spanner.Statement{
+			SQL:    "DELETE FROM users WHERE name = @p0 AND age > @p1",
+			Params: map[string]interface{}{"p1": int64(3), "p0": "a"},
+		}}
+		Expect(dml.String()).To(Equal(`PARTITIONED DML DELETE FROM users WHERE name = @p0 AND age > @p1 [@p0="a", @p1=3]`))
+	})
+
+	It("plans mutations without applying them", func() {
+		// the connection has no client, applying would panic
+		c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{DryRun: true})
+		mut := spanner.Delete("users", spanner.Key{1})
+		Expect(c.WriteMutations(context.Background(), mut)).To(BeNil())
+		Expect(c.PlannedWrites()).To(HaveLen(1))
+		Expect(c.PlannedWrites()[0].Op).To(Equal("MUTATION"))
+		Expect(c.PlannedWrites()[0].Mutation).To(BeIdenticalTo(mut))
+		_, err := c.CommitTimestamp()
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("plans DDL, and puts the planned writes on the result", func() {
+		c := sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{DryRun: true})
+		res, err := exec(c, "CREATE TABLE t (id INT64) PRIMARY KEY (id)")
+		Expect(err).To(BeNil())
+		planned := res.(plannedResult).PlannedWrites()
+		Expect(planned).To(HaveLen(1))
+		Expect(planned[0].String()).To(Equal("DDL CREATE TABLE t (id INT64) PRIMARY KEY (id)"))
+	})
+
+	It("plans the statements of a batch when it runs", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		c.SetDryRun(true)
+		_, err := exec(c, "START BATCH DDL")
+		Expect(err).To(BeNil())
+		_, err = exec(c, "CREATE TABLE t (id INT64) PRIMARY KEY (id)")
+		Expect(err).To(BeNil())
+		_, err = exec(c, "CREATE INDEX t_by_id ON t(id)")
+		Expect(err).To(BeNil())
+		Expect(c.PlannedWrites()).To(BeEmpty())
+		res, err := exec(c, "RUN BATCH")
+		Expect(err).To(BeNil())
+		Expect(res.(plannedResult).PlannedWrites()).To(HaveLen(2))
+	})
+
+	It("goes back to the configured mode when the session is reset", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		c.SetDryRun(true)
+		Expect(c.ResetSession(context.Background())).To(BeNil())
+		Expect(c.DryRun()).To(BeFalse())
+	})
+})
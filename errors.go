@@ -30,7 +30,206 @@
 
 package sqlspanner
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
 const (
 	UnsupportedError   = "Unsupported"
 	UnimplementedError = "Unimplemented"
 )
+
+// ParseError is returned for a query the driver could not parse
+type ParseError struct {
+	Query string
+	// the byte offset in Query the parser stopped at, or -1 if it is not known
+	Pos int
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("could not parse %q: %v", e.Query, e.Err)
+	}
+	return fmt.Sprintf("could not parse %q at position %d: %v", e.Query, e.Pos, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+var parsePositionRegexp = regexp.MustCompile(`position (\d+)`)
+
+func newParseError(query string, err error) *ParseError {
+	pos := -1
+	if matches := parsePositionRegexp.FindStringSubmatch(err.Error()); matches != nil {
+		fmt.Sscan(matches[1], &pos)
+	}
+	return &ParseError{Query: query, Pos: pos, Err: err}
+}
+
+// UnsupportedSQLError is returned for sql the driver can parse, but cannot
+// turn into something spanner runs
+type UnsupportedSQLError struct {
+	// the offending part of the query, like "OR" or "subqueries"
+	Construct string
+	// the kind of statement it was found in, empty if it is not known
+	Statement string
+}
+
+func (e *UnsupportedSQLError) Error() string {
+	if e.Statement == "" {
+		return fmt.Sprintf("%s not supported", e.Construct)
+	}
+	return fmt.Sprintf("%s not supported in %s statements", e.Construct, e.Statement)
+}
+
+// errors.Is(err, &UnsupportedSQLError{}) matches any unsupported sql, setting
+// Construct or Statement only matches errors with the same values
+func (e *UnsupportedSQLError) Is(target error) bool {
+	t, ok := target.(*UnsupportedSQLError)
+	if !ok {
+		return false
+	}
+	return (t.Construct == "" || t.Construct == e.Construct) &&
+		(t.Statement == "" || t.Statement == e.Statement)
+}
+
+// the name of a parsed sql node's type, like BinaryExpr
+func nodeName(node interface{}) string {
+	name := fmt.Sprintf("%T", node)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// ConversionError is returned when a value cannot be converted between go and spanner
+type ConversionError struct {
+	// the column name, or the arg position for query args
+	Column string
+	// the spanner type of a column read, or the go type of a value written
+	Type string
+	Err  error
+}
+
+func (e *ConversionError) Error() string {
+	return fmt.Sprintf("cannot convert %s (%s): %v", e.Column, e.Type, e.Err)
+}
+
+func (e *ConversionError) Unwrap() error {
+	return e.Err
+}
+
+// ReadOnlyError is returned for writes on a read only connection
+type ReadOnlyError struct {
+	// the kind of write, like INSERT, DDL, or mutations
+	Statement string
+}
+
+func (e *ReadOnlyError) Error() string {
+	return fmt.Sprintf("cannot run %s on a read only connection", e.Statement)
+}
+
+// UnboundedWriteError is returned for an UPDATE, DELETE, or delete mutation that
+// may change every row of its table, when the connection does not allow unbounded writes
+type UnboundedWriteError struct {
+	Statement string
+	Table     string
+}
+
+func (e *UnboundedWriteError) Error() string {
+	return fmt.Sprintf("%s on %s is not bounded to some of its rows, set allowUnboundedWrites to run it", e.Statement, e.Table)
+}
+
+// SpannerError wraps the errors returned by spanner
+type SpannerError struct {
+	Code codes.Code
+	Err  error
+}
+
+func (e *SpannerError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *SpannerError) Unwrap() error {
+	return e.Err
+}
+
+// errors.Is(err, &SpannerError{Code: codes.NotFound}) matches spanner errors
+// with the same code. Spanner does not keep the context's error, so canceled
+// and deadline exceeded errors match context.Canceled and context.DeadlineExceeded
+func (e *SpannerError) Is(target error) bool {
+	switch target {
+	case context.Canceled:
+		return e.Code == codes.Canceled
+	case context.DeadlineExceeded:
+		return e.Code == codes.DeadlineExceeded
+	}
+	t, ok := target.(*SpannerError)
+	return ok && t.Err == nil && t.Code == e.Code
+}
+
+// lets status.FromError and status.Code find the grpc status
+func (e *SpannerError) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Err.Error())
+}
+
+// wraps an error spanner returned in a *SpannerError. Errors that did not come
+// from spanner, like io.EOF or iterator.Done, are returned as is
+func spannerError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var se *SpannerError
+	if errors.As(err, &se) {
+		return err
+	}
+	var grpcErr interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &grpcErr) {
+		return err
+	}
+	return &SpannerError{Code: spanner.ErrCode(err), Err: err}
+}
+
+// ErrorCode is the grpc code of a spanner error, codes.OK for nil, and
+// codes.Unknown for errors that did not come from spanner
+func ErrorCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var se *SpannerError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return spanner.ErrCode(err)
+}
+
+// IsRetryable reports if running the same request again may succeed
+func IsRetryable(err error) bool {
+	switch ErrorCode(err) {
+	case codes.Aborted, codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// IsNotFound reports if a table, row, or database did not exist
+func IsNotFound(err error) bool {
+	return ErrorCode(err) == codes.NotFound
+}
+
+// IsAlreadyExists reports if an insert was for a row that already exists
+func IsAlreadyExists(err error) bool {
+	return ErrorCode(err) == codes.AlreadyExists
+}
+
+// IsAborted reports if spanner aborted a transaction, it can be run again
+func IsAborted(err error) bool {
+	return ErrorCode(err) == codes.Aborted
+}
@@ -0,0 +1,128 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Errors", func() {
+	It("wraps spanner errors with their code", func() {
+		err := sqlspanner.WrapSpannerError(spanner.ToSpannerError(status.Error(codes.NotFound, "table not found")))
+		var se *sqlspanner.SpannerError
+		Expect(errors.As(err, &se)).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(se.Code).To(Equal(codes.NotFound))
+		Expect(errors.Is(err, &sqlspanner.SpannerError{Code: codes.NotFound})).To(BeTrue())
+		Expect(errors.Is(err, &sqlspanner.SpannerError{Code: codes.Aborted})).To(BeFalse())
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+		Expect(sqlspanner.ErrorCode(fmt.Errorf("reading: %w", err))).To(Equal(codes.NotFound))
+	})
+
+	It("unwraps to the context's error", func() {
+		err := sqlspanner.WrapSpannerError(spanner.ToSpannerError(context.Canceled))
+		Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+		Expect(sqlspanner.ErrorCode(err)).To(Equal(codes.Canceled))
+	})
+
+	It("leaves errors that did not come from spanner alone", func() {
+		Expect(sqlspanner.WrapSpannerError(nil)).To(BeNil())
+		Expect(sqlspanner.WrapSpannerError(io.EOF)).To(Equal(io.EOF))
+		Expect(sqlspanner.ErrorCode(io.EOF)).To(Equal(codes.Unknown))
+		Expect(sqlspanner.ErrorCode(nil)).To(Equal(codes.OK))
+	})
+
+	It("classifies errors by their code", func() {
+		Expect(sqlspanner.IsRetryable(status.Error(codes.Unavailable, "unavailable"))).To(BeTrue())
+		Expect(sqlspanner.IsRetryable(status.Error(codes.InvalidArgument, "bad sql"))).To(BeFalse())
+		Expect(sqlspanner.IsRetryable(nil)).To(BeFalse())
+		Expect(sqlspanner.IsNotFound(status.Error(codes.NotFound, "no table"))).To(BeTrue())
+		Expect(sqlspanner.IsAlreadyExists(status.Error(codes.AlreadyExists, "row exists"))).To(BeTrue())
+		Expect(sqlspanner.IsAborted(sqlspanner.WrapSpannerError(status.Error(codes.Aborted, "aborted")))).To(BeTrue())
+		Expect(sqlspanner.IsAborted(io.EOF)).To(BeFalse())
+	})
+
+	It("matches unsupported sql by construct", func() {
+		err := fmt.Errorf("preparing: %w", &sqlspanner.UnsupportedSQLError{Construct: "OR", Statement: "DELETE"})
+		Expect(errors.Is(err, &sqlspanner.UnsupportedSQLError{})).To(BeTrue())
+		Expect(errors.Is(err, &sqlspanner.UnsupportedSQLError{Construct: "OR"})).To(BeTrue())
+		Expect(errors.Is(err, &sqlspanner.UnsupportedSQLError{Construct: "EXISTS"})).To(BeFalse())
+		Expect(err.Error()).To(Equal("preparing: OR not supported in DELETE statements"))
+	})
+
+	It("reports the position of parse errors", func() {
+		err := &sqlspanner.ParseError{Query: "UPDATE", Pos: 7, Err: errors.New("syntax error")}
+		Expect(err.Error()).To(Equal(`could not parse "UPDATE" at position 7: syntax error`))
+		Expect(errors.Unwrap(err).Error()).To(Equal("syntax error"))
+	})
+
+	It("returns parse errors for queries that cannot be parsed", func() {
+		_, err := sqlspanner.PrepareRawSelect(sqlspanner.NewUnconnectedConn(), "UPDATE SET WHERE")
+		var pe *sqlspanner.ParseError
+		Expect(errors.As(err, &pe)).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(pe.Query).To(Equal("UPDATE SET WHERE"))
+	})
+
+	It("reports the column a value could not be converted for", func() {
+		loader := sqlspanner.NewTestBulkLoader("users", []string{"id", "name"}, func(context.Context, []*spanner.Mutation) error {
+			return nil
+		})
+		err := loader.Add(context.Background(), int64(1), make(chan int))
+		var ce *sqlspanner.ConversionError
+		Expect(errors.As(err, &ce)).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(ce.Column).To(Equal("name"))
+		Expect(ce.Type).To(Equal("chan int"))
+
+		// a JSON value that cannot be marshaled
+		unmarshalable := spanner.NullJSON{Value: make(chan int), Valid: true}
+		err = loader.Add(context.Background(), int64(1), unmarshalable)
+		Expect(errors.As(err, &ce)).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(ce.Type).To(Equal("spanner.NullJSON"))
+
+		st, err := sqlspanner.NewUnconnectedConn().Prepare("START BATCH DML")
+		Expect(err).To(BeNil())
+		_, err = st.(driver.ColumnConverter).ColumnConverter(0).ConvertValue(unmarshalable)
+		Expect(errors.As(err, &ce)).To(BeTrue(), fmt.Sprintf("%T", err))
+		Expect(ce.Column).To(Equal("arg 1"))
+		Expect(ce.Type).To(Equal("spanner.NullJSON"))
+	})
+})
@@ -0,0 +1,200 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"google.golang.org/api/iterator"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
+)
+
+var explainRegexp = regexp.MustCompile(`(?is)^\s*explain\s+(analyze\s+)?(.*)$`)
+
+// strips a leading EXPLAIN, or EXPLAIN ANALYZE from query, and returns the spanner
+// query mode the rest of the query should run with. EXPLAIN only plans the query,
+// EXPLAIN ANALYZE runs it, and collects execution statistics for every plan node.
+// mode is nil if the query is not being explained
+func explainMode(query string) (mode *v1.ExecuteSqlRequest_QueryMode, rest string) {
+	match := explainRegexp.FindStringSubmatch(query)
+	if match == nil {
+		return nil, query
+	}
+	m := v1.ExecuteSqlRequest_PLAN
+	if match[1] != "" {
+		m = v1.ExecuteSqlRequest_PROFILE
+	}
+	return &m, match[2]
+}
+
+// runs the statement with the stmt's query mode, discarding any rows it returns,
+// and turns the resulting query plan into rows. Each relational plan node is a row with
+// columns:
+//   id:              the index of the plan node
+//   plan:            the node's name, indented to show the plan tree
+//   kind:            RELATIONAL
+//   metadata:        the node's metadata as JSON
+//   execution_stats: (EXPLAIN ANALYZE only) the node's execution statistics as JSON
+func (s *stmt) explainQuery(ctx context.Context, spannerStmt spanner.Statement) (*rows, error) {
+	iter := s.conn.client.Single().QueryWithOptions(ctx, spannerStmt, spanner.QueryOptions{Mode: s.queryMode})
+	defer iter.Stop()
+	for {
+		_, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, spannerError(err)
+		}
+	}
+	profile := *s.queryMode == v1.ExecuteSqlRequest_PROFILE
+	next, err := newPlanNextable(iter.QueryPlan, iter.QueryStats, profile)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsFromNextable(next), nil
+}
+
+// a nextable over the rows of an explained query plan
+type planNextable struct {
+	rows     []*spanner.Row
+	metadata *v1.ResultSetMetadata
+	stats    map[string]interface{}
+}
+
+func newPlanNextable(plan *v1.QueryPlan, stats map[string]interface{}, profile bool) (*planNextable, error) {
+	cols := []string{"id", "plan", "kind", "metadata"}
+	types := []v1.TypeCode{v1.TypeCode_INT64, v1.TypeCode_STRING, v1.TypeCode_STRING, v1.TypeCode_JSON}
+	if profile {
+		cols = append(cols, "execution_stats")
+		types = append(types, v1.TypeCode_JSON)
+	}
+	fields := make([]*v1.StructType_Field, len(cols))
+	for i, col := range cols {
+		fields[i] = &v1.StructType_Field{Name: col, Type: &v1.Type{Code: types[i]}}
+	}
+	p := &planNextable{
+		metadata: &v1.ResultSetMetadata{RowType: &v1.StructType{Fields: fields}},
+		stats:    stats,
+	}
+	nodes := plan.GetPlanNodes()
+	if len(nodes) == 0 {
+		return p, nil
+	}
+	var walk func(node *v1.PlanNode, depth int) error
+	walk = func(node *v1.PlanNode, depth int) error {
+		text := node.DisplayName
+		if desc := node.GetShortRepresentation().GetDescription(); desc != "" {
+			text += " (" + desc + ")"
+		}
+		if depth > 0 {
+			text = strings.Repeat("  ", depth-1) + "+- " + text
+		}
+		vals := []interface{}{int64(node.Index), text, node.Kind.String(), structToJSON(node.Metadata.AsMap(), node.Metadata != nil)}
+		if profile {
+			vals = append(vals, structToJSON(node.ExecutionStats.AsMap(), node.ExecutionStats != nil))
+		}
+		row, err := spanner.NewRow(cols, vals)
+		if err != nil {
+			return err
+		}
+		p.rows = append(p.rows, row)
+		for _, link := range node.ChildLinks {
+			if link.ChildIndex < 0 || int(link.ChildIndex) >= len(nodes) {
+				return fmt.Errorf("query plan node %d has an invalid child %d", node.Index, link.ChildIndex)
+			}
+			child := nodes[link.ChildIndex]
+			if child.Kind != v1.PlanNode_RELATIONAL {
+				continue
+			}
+			if err := walk(child, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	// the first node is always the root of the plan
+	if err := walk(nodes[0], 0); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func structToJSON(m map[string]interface{}, valid bool) spanner.NullJSON {
+	if !valid {
+		return spanner.NullJSON{}
+	}
+	return spanner.NullJSON{Value: m, Valid: true}
+}
+
+func (p *planNextable) Next() (*spanner.Row, error) {
+	if len(p.rows) == 0 {
+		return nil, iterator.Done
+	}
+	row := p.rows[0]
+	p.rows = p.rows[1:]
+	return row, nil
+}
+
+func (p *planNextable) Stop() {
+	p.rows = nil
+}
+
+func (p *planNextable) Metadata() *v1.ResultSetMetadata {
+	return p.metadata
+}
+
+func (p *planNextable) QueryStats() map[string]interface{} {
+	return p.stats
+}
+
+// LastQueryStats returns the execution statistics spanner reported for the last
+// query run on c. Statistics are only collected for EXPLAIN ANALYZE queries,
+// or for every query when the connection was opened with queryStats=true.
+// They are available once every row of the query has been read.
+func LastQueryStats(c *sql.Conn) (map[string]interface{}, error) {
+	var stats map[string]interface{}
+	err := c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a spanner connection: %T", driverConn)
+		}
+		stats = sc.LastQueryStats()
+		return nil
+	})
+	return stats, err
+}
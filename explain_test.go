@@ -0,0 +1,110 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+
+package sqlspanner_test
+
+import (
+	"database/sql/driver"
+	"io"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/types/known/structpb"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Explain", func() {
+	Describe("detecting explained queries", func() {
+		It("uses PLAN mode for EXPLAIN", func() {
+			mode, query := sqlspanner.ExplainMode("explain SELECT * FROM t")
+			Expect(*mode).To(Equal(v1.ExecuteSqlRequest_PLAN))
+			Expect(query).To(Equal("SELECT * FROM t"))
+		})
+
+		It("uses PROFILE mode for EXPLAIN ANALYZE", func() {
+			mode, query := sqlspanner.ExplainMode("  EXPLAIN ANALYZE\n SELECT * FROM t")
+			Expect(*mode).To(Equal(v1.ExecuteSqlRequest_PROFILE))
+			Expect(query).To(Equal("SELECT * FROM t"))
+		})
+
+		It("leaves other queries alone", func() {
+			mode, query := sqlspanner.ExplainMode("SELECT explain FROM t")
+			Expect(mode).To(BeNil())
+			Expect(query).To(Equal("SELECT explain FROM t"))
+		})
+	})
+
+	Describe("turning a query plan into rows", func() {
+		meta, _ := structpb.NewStruct(map[string]interface{}{"scan_type": "TableScan"})
+		execStats, _ := structpb.NewStruct(map[string]interface{}{"rows": "2"})
+		plan := &v1.QueryPlan{PlanNodes: []*v1.PlanNode{
+			{Index: 0, Kind: v1.PlanNode_RELATIONAL, DisplayName: "Distributed Union",
+				ChildLinks: []*v1.PlanNode_ChildLink{{ChildIndex: 1}, {ChildIndex: 2}}},
+			{Index: 1, Kind: v1.PlanNode_RELATIONAL, DisplayName: "Scan", Metadata: meta, ExecutionStats: execStats,
+				ShortRepresentation: &v1.PlanNode_ShortRepresentation{Description: "test_table1"}},
+			{Index: 2, Kind: v1.PlanNode_SCALAR, DisplayName: "Constant"},
+		}}
+
+		It("returns one row per relational node, in tree order", func() {
+			rows, err := sqlspanner.NewRowsFromQueryPlan(plan, nil, false)
+			Expect(err).To(BeNil())
+			Expect(rows.Columns()).To(Equal([]string{"id", "plan", "kind", "metadata"}))
+
+			row := make([]driver.Value, 4)
+			Expect(rows.Next(row)).To(BeNil())
+			Expect(row).To(BeEquivalentTo([]driver.Value{int64(0), "Distributed Union", "RELATIONAL", spanner.NullJSON{}}))
+			Expect(rows.Next(row)).To(BeNil())
+			Expect(row).To(BeEquivalentTo([]driver.Value{int64(1), "+- Scan (test_table1)", "RELATIONAL",
+				spanner.NullJSON{Value: map[string]interface{}{"scan_type": "TableScan"}, Valid: true}}))
+			Expect(rows.Next(row)).To(Equal(io.EOF))
+		})
+
+		It("includes execution statistics when profiling", func() {
+			rows, err := sqlspanner.NewRowsFromQueryPlan(plan, map[string]interface{}{"elapsed_time": "1 msecs"}, true)
+			Expect(err).To(BeNil())
+			Expect(rows.Columns()).To(Equal([]string{"id", "plan", "kind", "metadata", "execution_stats"}))
+			row := make([]driver.Value, 5)
+			Expect(rows.Next(row)).To(BeNil())
+			Expect(rows.Next(row)).To(BeNil())
+			Expect(row[4]).To(BeEquivalentTo(spanner.NullJSON{Value: map[string]interface{}{"rows": "2"}, Valid: true}))
+		})
+
+		It("has columns for an empty plan", func() {
+			rows, err := sqlspanner.NewRowsFromQueryPlan(&v1.QueryPlan{}, nil, false)
+			Expect(err).To(BeNil())
+			Expect(rows.Columns()).To(Equal([]string{"id", "plan", "kind", "metadata"}))
+			Expect(rows.Next(make([]driver.Value, 4))).To(Equal(io.EOF))
+		})
+	})
+})
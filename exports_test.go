@@ -31,12 +31,17 @@
 package sqlspanner
 
 import (
+	"context"
+	"database/sql"
 	"database/sql/driver"
+	"fmt"
+	"math/big"
 	"time"
 
 	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 	"google.golang.org/api/iterator"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
 )
 
 // This file exports our private functions for testing
@@ -45,8 +50,192 @@ var (
 	NewRowsFromSpannerIterator = newRowsFromSpannerIterator
 	NewRowsFromNextable        = newRowsFromNextable
 	NewRowsFromSpannerRow      = newRowsFromSpannerRow
+	ExplainMode                = explainMode
+	IsSelect                   = isSelect
+	ToNamedParams              = toNamedParams
+	NewTestBulkLoader          = newBulkLoader
+	ExtractPointLookup         = extractPointLookup
+	StripHints                 = stripHints
+	ParseRunPartition          = parseRunPartition
+	EncodePartition            = encodePartition
+	DecodePartition            = decodePartition
+	WrapSpannerError           = spannerError
 )
 
+// the records of a change stream row, by kind
+func DecodeChangeRecord(record spanner.NullRow) ([]*DataChangeRecord, []time.Time, map[string]time.Time, error) {
+	rec, err := decodeChangeRecord(record)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var heartbeats []time.Time
+	for _, hb := range rec.HeartbeatRecords {
+		heartbeats = append(heartbeats, hb.Timestamp)
+	}
+	children := make(map[string]time.Time)
+	for _, cpr := range rec.ChildPartitionsRecords {
+		for _, child := range cpr.ChildPartitions {
+			children[child.Token] = cpr.StartTimestamp
+		}
+	}
+	return rec.DataChangeRecords, heartbeats, children, nil
+}
+
+// a change stream reader that runs its partitions' queries with query
+func NewTestChangeStreamReader(stream string, start time.Time, query func(ctx context.Context, stmt spanner.Statement, each func([]spanner.NullRow) error) error) *ChangeStreamReader {
+	r := NewChangeStreamReader(nil, stream, start)
+	r.query = query
+	return r
+}
+
+func IsBatchCommand(query string) bool {
+	return parseBatchCommand(query) != batchNone
+}
+
+func ParseSetDMLMode(query string) (AutocommitDMLMode, bool, error) {
+	mode, ok, err := parseSetDMLMode(query)
+	if mode == nil {
+		return AutocommitDMLModeTransactional, ok, err
+	}
+	return *mode, ok, err
+}
+
+func IsCommitTimestamp(v interface{}) bool {
+	return isCommitTimestamp(v)
+}
+
+// a connection that is not connected to spanner, for testing what the driver
+// does before sending anything
+func NewUnconnectedConn() *conn {
+	return NewUnconnectedConnWithConfig(&Config{})
+}
+
+func NewUnconnectedConnWithConfig(cfg *Config) *conn {
+	return &conn{ctx: context.Background(), cfg: cfg, dmlMode: cfg.AutocommitDMLMode, dryRun: cfg.DryRun}
+}
+
+// the key range a DELETE with the given keys would remove, and if it is bounded
+func PackKeySet(keys ...*Key) (*MergableKeyRange, bool, error) {
+	a := &AwareKeySet{Keys: make(map[string]*Key)}
+	for _, k := range keys {
+		a.Keys[k.Name] = k
+		a.KeyOrder = append(a.KeyOrder, k.Name)
+	}
+	mkr, err := a.packKeySet()
+	return mkr, mkr.bounded(), err
+}
+
+func CheckBadConn(c *conn, err error) error {
+	return c.checkBadConn(err)
+}
+
+func BufferedMutations(c *conn) []*spanner.Mutation {
+	if c.tx == nil {
+		return nil
+	}
+	return c.tx.mutations
+}
+
+func (p *pointLookup) Table() string {
+	return p.table
+}
+
+func (p *pointLookup) Index() string {
+	return p.index
+}
+
+func (p *pointLookup) Columns() []string {
+	return p.columns
+}
+
+// reads the lookup with the connection of c, ok is false when it has to be queried
+func (p *pointLookup) Read(ctx context.Context, c *sql.Conn, args ...driver.Value) (ok bool, err error) {
+	err = c.Raw(func(driverConn interface{}) error {
+		var iter *spanner.RowIterator
+		iter, ok, err = p.read(ctx, driverConn.(*conn), args)
+		if iter != nil {
+			iter.Stop()
+		}
+		return err
+	})
+	return ok, err
+}
+
+// caches the key columns of table@index on c, as if they were read from the information schema
+func CacheIndexColumns(c *sql.Conn, table, index string, keys ...string) error {
+	return c.Raw(func(driverConn interface{}) error {
+		sc := driverConn.(*conn)
+		if sc.indexes == nil {
+			sc.indexes = make(map[string]*indexColumns)
+		}
+		sc.indexes[table+"@"+index] = &indexColumns{keys: keys}
+		return nil
+	})
+}
+
+// the number of indexes whose columns are cached on c
+func CachedIndexes(c *sql.Conn) (n int, err error) {
+	err = c.Raw(func(driverConn interface{}) error {
+		n = len(driverConn.(*conn).indexes)
+		return nil
+	})
+	return n, err
+}
+
+// the values each filtered column is compared to
+func (p *pointLookup) KeyValues() map[string][]interface{} {
+	vals := make(map[string][]interface{})
+	for name, key := range p.keys.Keys {
+		if key.InValues != nil {
+			vals[name] = key.InValues
+		} else {
+			vals[name] = []interface{}{key.LowerValue}
+		}
+	}
+	return vals
+}
+
+func (h *queryHints) Statement() map[string]string {
+	return h.statement
+}
+
+func (h *queryHints) Table(name string) map[string]string {
+	return h.tables[name]
+}
+
+func (h *queryHints) Join() bool {
+	return h.join
+}
+
+// prepares query, returning the query that would be sent to spanner for a
+// select the parser could not parse
+func PrepareRawSelect(c *conn, query string) (string, error) {
+	st, err := newStmt(query, c)
+	if err != nil {
+		return "", err
+	}
+	s := st.(*stmt)
+	if !s.rawSelect {
+		return "", fmt.Errorf("%q was parsed", query)
+	}
+	return s.updatedQuery, nil
+}
+
+func NewRowsFromQueryPlan(plan *v1.QueryPlan, stats map[string]interface{}, profile bool) (*rows, error) {
+	next, err := newPlanNextable(plan, stats, profile)
+	if err != nil {
+		return nil, err
+	}
+	return newRowsFromNextable(next), nil
+}
+
+
+func NewStandardRowsFromNextable(iter nextable) *rows {
+	r := newRowsFromNextable(iter)
+	r.valuer.mode = ResultModeStandard
+	return r
+}
+
 type TestNextable struct {
 	cur  int
 	max  int
@@ -64,6 +253,8 @@ func (n *TestNextable) Next() (*spanner.Row, error) {
 			return n.timeRow()
 		case "structs":
 			return n.structRow()
+		case "numerics":
+			return n.numericRow()
 		default:
 			return n.valueRow()
 		}
@@ -108,6 +299,31 @@ func (n *TestNextable) WhatTimeRowShouldBe() []driver.Value {
 	}
 }
 
+func (n *TestNextable) numericRow() (*spanner.Row, error) {
+	return spanner.NewRow([]string{"a", "b", "c", "d", "e", "f"}, []interface{}{
+		big.NewRat(3, 2), spanner.NullNumeric{},
+		[]*big.Rat{big.NewRat(1, 4), nil},
+		spanner.NullJSON{Value: map[string]interface{}{"a": "b"}, Valid: true},
+		spanner.NullJSON{},
+		[]spanner.NullJSON{spanner.NullJSON{Value: []interface{}{"a"}, Valid: true}, spanner.NullJSON{}},
+	})
+}
+
+func (n *TestNextable) WhatNumericRowShouldBe() []driver.Value {
+	return []driver.Value{big.NewRat(3, 2), spanner.NullNumeric{},
+		[]spanner.NullNumeric{
+			spanner.NullNumeric{Numeric: *big.NewRat(1, 4), Valid: true},
+			spanner.NullNumeric{},
+		},
+		spanner.NullJSON{Value: map[string]interface{}{"a": "b"}, Valid: true},
+		spanner.NullJSON{},
+		[]spanner.NullJSON{
+			spanner.NullJSON{Value: []interface{}{"a"}, Valid: true},
+			spanner.NullJSON{},
+		},
+	}
+}
+
 func (n *TestNextable) valueRow() (*spanner.Row, error) {
 	return spanner.NewRow([]string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"},
 		[]interface{}{true, int64(2), float64(3.3), "1", []byte("bytes"),
@@ -136,6 +352,20 @@ func (n *TestNextable) WhatValueRowShouldBe() []driver.Value {
 	}
 }
 
+func (n *TestNextable) WhatStandardValueRowShouldBe() []driver.Value {
+	return []driver.Value{true, int64(2), float64(3.3), "1", []byte("bytes"),
+		[]interface{}{true, true}, []interface{}{int64(2), int64(2)},
+		[]interface{}{float64(3.3), float64(3.3)}, []interface{}{"1", "1"},
+		[]interface{}{[]byte("bytes"), []byte("bytes")},
+	}
+}
+
+func (n *TestNextable) WhatStandardNumericRowShouldBe() []driver.Value {
+	return []driver.Value{"1.500000000", nil, []interface{}{"0.250000000", nil},
+		[]byte(`{"a":"b"}`), nil, []interface{}{[]byte(`["a"]`), nil},
+	}
+}
+
 func (n *TestNextable) Stop() {
 	n.cur = n.max
 }
@@ -143,3 +373,29 @@ func (n *TestNextable) Stop() {
 func NewTestNextable(iterations int, name string) *TestNextable {
 	return &TestNextable{cur: 0, max: iterations, name: name, now: time.Now().UTC().Truncate(time.Millisecond)}
 }
+
+// a TestNextable that reports its result set metadata, even if it has no rows
+type TestMetadataNextable struct {
+	*TestNextable
+}
+
+func (n *TestMetadataNextable) Metadata() *v1.ResultSetMetadata {
+	var row *spanner.Row
+	switch n.name {
+	case "times":
+		row, _ = n.timeRow()
+	case "numerics":
+		row, _ = n.numericRow()
+	default:
+		row, _ = n.valueRow()
+	}
+	fields := make([]*v1.StructType_Field, row.Size())
+	for i := range fields {
+		fields[i] = &v1.StructType_Field{Name: row.ColumnName(i), Type: row.ColumnType(i)}
+	}
+	return &v1.ResultSetMetadata{RowType: &v1.StructType{Fields: fields}}
+}
+
+func NewTestMetadataNextable(iterations int, name string) *TestMetadataNextable {
+	return &TestMetadataNextable{NewTestNextable(iterations, name)}
+}
@@ -0,0 +1,204 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package fake is an in process spanner database for hermetic tests. Importing it
+// registers the fake:// data source name scheme with the sqlspanner driver
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/spanner/spannertest"
+	"cloud.google.com/go/spanner/spansql"
+	"github.com/tcncloud/sqlspanner"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const scheme = "fake"
+
+// the open databases by name, for fake://<name> data source names
+var (
+	databasesMu sync.Mutex
+	databases   = make(map[string]*Database)
+)
+
+func init() {
+	sqlspanner.RegisterScheme(scheme, endpoint)
+}
+
+// Database is built on the spannertest package, and supports what it does: DDL,
+// mutations, reads by key, and a subset of spanner's sql. It has no INFORMATION_SCHEMA.
+// Open it with database/sql using its data source name, or create and open it with Open:
+//   fakeDB, db, err := fake.Open("users", "CREATE TABLE users (id INT64, name STRING(MAX)) PRIMARY KEY (id)")
+//   defer fakeDB.Close()
+// spannertest does not simulate transactions, aborts and other failures are injected
+// with FailNext
+type Database struct {
+	name string
+	srv  *spannertest.Server
+
+	mu sync.Mutex
+	// the errors the next calls of each rpc return, in order
+	failures map[string][]error
+	// opened by Open, and closed with the database
+	db *sql.DB
+}
+
+// New starts a fake database that fake://<name> connects to, until it is closed
+func New(name string) (*Database, error) {
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	if _, ok := databases[name]; ok {
+		return nil, fmt.Errorf("a fake database named %q is already open", name)
+	}
+	// the fake is only reachable through the loopback interface
+	srv, err := spannertest.NewServer("localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	srv.SetLogger(func(string, ...interface{}) {})
+	d := &Database{name: name, srv: srv, failures: make(map[string][]error)}
+	databases[name] = d
+	return d, nil
+}
+
+// Open starts a fake database with the schema of ddl, and opens it with database/sql.
+// The *sql.DB is closed when the database is
+func Open(name string, ddl ...string) (*Database, *sql.DB, error) {
+	d, err := New(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(ddl) > 0 {
+		if err := d.UpdateDDL(ddl...); err != nil {
+			d.Close()
+			return nil, nil, err
+		}
+	}
+	d.db, err = sql.Open("spanner", d.DSN())
+	if err != nil {
+		d.Close()
+		return nil, nil, err
+	}
+	return d, d.db, nil
+}
+
+func (d *Database) DSN() string {
+	return scheme + "://" + d.name
+}
+
+// UpdateDDL creates the database's schema
+func (d *Database) UpdateDDL(statements ...string) error {
+	ddl, err := spansql.ParseDDL(d.name, strings.Join(statements, ";\n"))
+	if err != nil {
+		return err
+	}
+	return d.srv.UpdateDDL(ddl)
+}
+
+// FailNext makes the next call of a spanner rpc, like "Commit", "ExecuteStreamingSql",
+// or "StreamingRead", fail with err. Errors for the same rpc are returned in the order
+// they were added. An aborted commit is retried by the client, like spanner's are:
+//   db.FailNext("Commit", status.Error(codes.Aborted, "transaction aborted"))
+func (d *Database) FailNext(rpc string, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.failures[rpc] = append(d.failures[rpc], err)
+}
+
+// the injected error for a call of method, nil if the call should go to the fake
+func (d *Database) nextFailure(method string) error {
+	rpc := method[strings.LastIndex(method, "/")+1:]
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	errs := d.failures[rpc]
+	if len(errs) == 0 {
+		return nil
+	}
+	d.failures[rpc] = errs[1:]
+	return errs[0]
+}
+
+func (d *Database) Close() error {
+	var err error
+	if d.db != nil {
+		err = d.db.Close()
+	}
+	databasesMu.Lock()
+	defer databasesMu.Unlock()
+	delete(databases, d.name)
+	d.srv.Close()
+	return err
+}
+
+// Endpoint returns where the database is served, with the client options that
+// inject its failures
+func (d *Database) Endpoint() *sqlspanner.Endpoint {
+	unary := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if err := d.nextFailure(method); err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if err := d.nextFailure(method); err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+	return &sqlspanner.Endpoint{
+		Database: "projects/fake/instances/fake/databases/" + d.name,
+		Options: []option.ClientOption{
+			option.WithEndpoint(d.srv.Addr),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+			option.WithGRPCDialOption(grpc.WithChainUnaryInterceptor(unary)),
+			option.WithGRPCDialOption(grpc.WithChainStreamInterceptor(stream)),
+		},
+		NoInformationSchema: true,
+	}
+}
+
+// looks the database of a fake://<name> data source name up
+func endpoint(name string) (*sqlspanner.Endpoint, error) {
+	databasesMu.Lock()
+	d := databases[name]
+	databasesMu.Unlock()
+	if d == nil {
+		return nil, fmt.Errorf("no fake database named %q is open, start it with New", name)
+	}
+	return d.Endpoint(), nil
+}
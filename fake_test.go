@@ -0,0 +1,217 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"context"
+	"database/sql"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"github.com/tcncloud/sqlspanner/fake"
+	"github.com/xwb1989/sqlparser"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// the fake, as if it had an information schema like spanner does
+var withSchema *fake.Database
+
+func init() {
+	sqlspanner.RegisterScheme("fakewithschema", func(string) (*sqlspanner.Endpoint, error) {
+		ep := withSchema.Endpoint()
+		ep.NoInformationSchema = false
+		return ep, nil
+	})
+}
+
+var _ = Describe("Fake", func() {
+	var (
+		ctx    context.Context
+		fakeDB *fake.Database
+		db     *sql.DB
+		conn   *sql.Conn
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		fakeDB, db, err = fake.Open("fake_test", "CREATE TABLE users (id INT64 NOT NULL, name STRING(MAX)) PRIMARY KEY (id)")
+		Expect(err).To(BeNil())
+		conn, err = db.Conn(ctx)
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(conn.Close()).To(BeNil())
+		Expect(fakeDB.Close()).To(BeNil())
+	})
+
+	names := func() []string {
+		rows, err := db.QueryContext(ctx, "SELECT name FROM users WHERE id >= ? ORDER BY id", 1)
+		Expect(err).To(BeNil())
+		defer rows.Close()
+		var names []string
+		for rows.Next() {
+			var name string
+			Expect(rows.Scan(&name)).To(BeNil())
+			names = append(names, name)
+		}
+		Expect(rows.Err()).To(BeNil())
+		return names
+	}
+
+	It("applies mutations, and queries them", func() {
+		err := sqlspanner.WriteMutations(ctx, conn,
+			spanner.Insert("users", []string{"id", "name"}, []interface{}{int64(1), "a"}),
+			spanner.Insert("users", []string{"id", "name"}, []interface{}{int64(2), "b"}),
+		)
+		Expect(err).To(BeNil())
+		Expect(names()).To(Equal([]string{"a", "b"}))
+	})
+
+	It("runs DDL", func() {
+		_, err := db.ExecContext(ctx, "CREATE TABLE teams (id INT64 NOT NULL) PRIMARY KEY (id)")
+		Expect(err).To(BeNil())
+		Expect(sqlspanner.WriteMutations(ctx, conn, spanner.Insert("teams", []string{"id"}, []interface{}{int64(1)}))).To(BeNil())
+	})
+
+	It("forgets the cached index columns after a schema change", func() {
+		Expect(sqlspanner.CacheIndexColumns(conn, "users", "", "id")).To(BeNil())
+		_, err := conn.ExecContext(ctx, "CREATE INDEX users_by_name ON users (name)")
+		Expect(err).To(BeNil())
+		Expect(sqlspanner.CachedIndexes(conn)).To(Equal(0))
+
+		Expect(sqlspanner.CacheIndexColumns(conn, "users", "users_by_name", "name")).To(BeNil())
+		for _, query := range []string{"START BATCH DDL", "DROP INDEX users_by_name", "RUN BATCH"} {
+			_, err = conn.ExecContext(ctx, query)
+			Expect(err).To(BeNil())
+		}
+		Expect(sqlspanner.CachedIndexes(conn)).To(Equal(0))
+	})
+
+	It("retries commits the fake aborts", func() {
+		fakeDB.FailNext("Commit", status.Error(codes.Aborted, "transaction aborted"))
+		err := sqlspanner.WriteMutations(ctx, conn, spanner.Insert("users", []string{"id", "name"}, []interface{}{int64(1), "a"}))
+		Expect(err).To(BeNil())
+		Expect(names()).To(Equal([]string{"a"}))
+	})
+
+	It("returns injected failures", func() {
+		fakeDB.FailNext("Commit", status.Error(codes.AlreadyExists, "row exists"))
+		err := sqlspanner.WriteMutations(ctx, conn, spanner.Insert("users", []string{"id", "name"}, []interface{}{int64(1), "a"}))
+		Expect(sqlspanner.IsAlreadyExists(err)).To(BeTrue())
+		Expect(names()).To(BeEmpty())
+	})
+
+	It("queries point lookups, the fake has no information schema to read their keys from", func() {
+		Expect(sqlspanner.WriteMutations(ctx, conn, spanner.Insert("users", []string{"id", "name"}, []interface{}{int64(1), "a"}))).To(BeNil())
+		var name string
+		Expect(conn.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ?", 1).Scan(&name)).To(BeNil())
+		Expect(name).To(Equal("a"))
+		fakeDB.FailNext("ExecuteStreamingSql", status.Error(codes.PermissionDenied, "denied"))
+		err := conn.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ?", 1).Scan(&name)
+		Expect(sqlspanner.ErrorCode(err)).To(Equal(codes.PermissionDenied))
+		Expect(conn.QueryRowContext(ctx, "SELECT name FROM users WHERE id = ?", 1).Scan(&name)).To(BeNil())
+	})
+
+	It("returns the information schema errors of point lookups on databases that have one", func() {
+		where := &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.ValArg("?")}
+		lookup := sqlspanner.ExtractPointLookup(selectFromUsers(where, "name"), nil)
+		Expect(lookup).ToNot(BeNil())
+		ok, err := lookup.Read(ctx, conn, int64(1))
+		Expect(err).To(BeNil())
+		Expect(ok).To(BeFalse())
+
+		withSchema = fakeDB
+		schemaDB, err := sql.Open("spanner", "fakewithschema://fake_test")
+		Expect(err).To(BeNil())
+		defer schemaDB.Close()
+		schemaConn, err := schemaDB.Conn(ctx)
+		Expect(err).To(BeNil())
+		defer schemaConn.Close()
+		// the error is not taken to mean there is no information schema
+		for i := 0; i < 2; i++ {
+			_, err = lookup.Read(ctx, schemaConn, int64(1))
+			Expect(sqlspanner.ErrorCode(err)).To(Equal(codes.InvalidArgument))
+		}
+	})
+
+	It("passes spanner's null types as args, instead of their Value", func() {
+		day := civil.Date{Year: 2024, Month: 3, Day: 1}
+		var got spanner.NullDate
+		err := db.QueryRowContext(ctx, "SELECT ?", spanner.NullDate{Date: day, Valid: true}).Scan(&got)
+		Expect(err).To(BeNil())
+		Expect(got).To(Equal(spanner.NullDate{Date: day, Valid: true}))
+	})
+
+	It("passes BYTES args", func() {
+		var b []byte
+		Expect(db.QueryRowContext(ctx, "SELECT ?", []byte("hi")).Scan(&b)).To(BeNil())
+		Expect(b).To(Equal([]byte("hi")))
+		var bs [][]byte
+		Expect(db.QueryRowContext(ctx, "SELECT ?", [][]byte{[]byte("a"), nil}).Scan(&bs)).To(BeNil())
+		Expect(bs).To(Equal([][]byte{[]byte("a"), nil}))
+	})
+
+	It("plans bulk loads on dry run connections, without writing them", func() {
+		dryDB, err := sql.Open("spanner", fakeDB.DSN()+"?dryRun=true")
+		Expect(err).To(BeNil())
+		defer dryDB.Close()
+		dryConn, err := dryDB.Conn(ctx)
+		Expect(err).To(BeNil())
+		defer dryConn.Close()
+		loader, err := sqlspanner.NewBulkLoader(dryConn, "users", []string{"id", "name"})
+		Expect(err).To(BeNil())
+		loader.MaxMutations = 2
+		Expect(loader.Add(ctx, int64(1), "a")).To(BeNil())
+		Expect(loader.Add(ctx, int64(2), "b")).To(BeNil())
+		Expect(loader.Flush(ctx)).To(BeNil())
+		Expect(names()).To(BeEmpty())
+		writes, err := sqlspanner.PlannedWrites(dryConn)
+		Expect(err).To(BeNil())
+		Expect(writes).To(HaveLen(2))
+		Expect(writes[0].Op).To(Equal("MUTATION"))
+	})
+
+	It("does not open fakes that were not started", func() {
+		db, err := sql.Open("spanner", "fake://nope")
+		Expect(err).To(BeNil())
+		Expect(db.PingContext(ctx)).ToNot(BeNil())
+		db, err = sql.Open("spanner", "nope://fake_test")
+		Expect(err).To(BeNil())
+		Expect(db.PingContext(ctx)).To(MatchError(ContainSubstring(`unknown data source name scheme "nope"`)))
+	})
+})
@@ -0,0 +1,138 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// spanner hints look like @{KEY=value, KEY2=value2}. They can start a statement,
+// follow a table name, or follow a JOIN:
+//   @{USE_ADDITIONAL_PARALLELISM=TRUE} SELECT a FROM t@{FORCE_INDEX=t_by_a} JOIN@{JOIN_METHOD=HASH_JOIN} u ON ...
+var hintRegexp = regexp.MustCompile(`(\w*)(\s*)@\{([^}]*)\}`)
+
+type queryHints struct {
+	statement map[string]string
+	// table hints by table name
+	tables map[string]map[string]string
+	join   bool
+}
+
+// the mysql parser does not understand hints, so they are removed before parsing.
+// The query sent to spanner keeps them. Strings, quoted identifiers, and comments
+// are left as they are, @{ in them is not a hint
+func stripHints(query string) (string, *queryHints, error) {
+	var h *queryHints
+	var err error
+	replace := func(match string) string {
+		sub := hintRegexp.FindStringSubmatch(match)
+		word, space, body := sub[1], sub[2], sub[3]
+		pairs, perr := parseHintPairs(body)
+		if perr != nil {
+			err = perr
+			return match
+		}
+		if h == nil {
+			h = &queryHints{statement: map[string]string{}, tables: map[string]map[string]string{}}
+		}
+		switch {
+		case word == "":
+			for k, v := range pairs {
+				h.statement[k] = v
+			}
+		case strings.EqualFold(word, "JOIN"):
+			h.join = true
+		default:
+			h.tables[word] = pairs
+		}
+		return word + space
+	}
+	var stripped strings.Builder
+	start := 0
+	for i := 0; i < len(query); {
+		if n := skipLiteral(query, i); n > i {
+			stripped.WriteString(hintRegexp.ReplaceAllStringFunc(query[start:i], replace))
+			stripped.WriteString(query[i:n])
+			i, start = n, n
+			continue
+		}
+		i++
+	}
+	stripped.WriteString(hintRegexp.ReplaceAllStringFunc(query[start:], replace))
+	if err != nil {
+		return "", nil, err
+	}
+	return stripped.String(), h, nil
+}
+
+func parseHintPairs(body string) (map[string]string, error) {
+	pairs := make(map[string]string)
+	for _, pair := range strings.Split(body, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid hint %q, hints look like @{KEY=value}", strings.TrimSpace(pair))
+		}
+		pairs[strings.ToUpper(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return pairs, nil
+}
+
+// the index a table hint forces, "" to read the base table
+func (h *queryHints) forcedIndex(table string) string {
+	if h == nil {
+		return ""
+	}
+	idx := h.tables[table]["FORCE_INDEX"]
+	if strings.EqualFold(idx, "_BASE_TABLE") {
+		return ""
+	}
+	return idx
+}
+
+// a point lookup can only honor FORCE_INDEX, other hints need the query engine
+func (h *queryHints) onlyForceIndex() bool {
+	if h == nil {
+		return true
+	}
+	if len(h.statement) != 0 || h.join {
+		return false
+	}
+	for _, pairs := range h.tables {
+		for k := range pairs {
+			if k != "FORCE_INDEX" {
+				return false
+			}
+		}
+	}
+	return true
+}
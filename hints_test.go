@@ -0,0 +1,87 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hints", func() {
+	It("leaves queries without hints alone", func() {
+		query := "SELECT a FROM t WHERE b = @b"
+		stripped, hints, err := sqlspanner.StripHints(query)
+		Expect(err).To(BeNil())
+		Expect(stripped).To(Equal(query))
+		Expect(hints).To(BeNil())
+	})
+
+	It("strips statement hints", func() {
+		stripped, hints, err := sqlspanner.StripHints("@{USE_ADDITIONAL_PARALLELISM=TRUE, optimizer_version=5} SELECT a FROM t")
+		Expect(err).To(BeNil())
+		Expect(stripped).To(Equal(" SELECT a FROM t"))
+		Expect(hints.Statement()).To(Equal(map[string]string{"USE_ADDITIONAL_PARALLELISM": "TRUE", "OPTIMIZER_VERSION": "5"}))
+	})
+
+	It("strips table hints", func() {
+		stripped, hints, err := sqlspanner.StripHints("SELECT a FROM t@{FORCE_INDEX=t_by_b} WHERE b = ?")
+		Expect(err).To(BeNil())
+		Expect(stripped).To(Equal("SELECT a FROM t WHERE b = ?"))
+		Expect(hints.Table("t")).To(Equal(map[string]string{"FORCE_INDEX": "t_by_b"}))
+		Expect(hints.Statement()).To(BeEmpty())
+	})
+
+	It("strips join hints", func() {
+		stripped, hints, err := sqlspanner.StripHints("SELECT t.a FROM t JOIN@{JOIN_METHOD=HASH_JOIN} u ON t.a = u.a")
+		Expect(err).To(BeNil())
+		Expect(stripped).To(Equal("SELECT t.a FROM t JOIN u ON t.a = u.a"))
+		Expect(hints.Join()).To(BeTrue())
+	})
+
+	It("leaves hints in strings, and comments alone", func() {
+		query := "INSERT INTO t (s, k) VALUES ('a@{b}', \"x@{K=v}\") -- t@{FORCE_INDEX=x}"
+		stripped, hints, err := sqlspanner.StripHints(query)
+		Expect(err).To(BeNil())
+		Expect(stripped).To(Equal(query))
+		Expect(hints).To(BeNil())
+		stripped, hints, err = sqlspanner.StripHints("SELECT a FROM t@{FORCE_INDEX=t_by_b} WHERE b = 'x@{K=v}'")
+		Expect(err).To(BeNil())
+		Expect(stripped).To(Equal("SELECT a FROM t WHERE b = 'x@{K=v}'"))
+		Expect(hints.Table("t")).To(Equal(map[string]string{"FORCE_INDEX": "t_by_b"}))
+	})
+
+	It("rejects malformed hints", func() {
+		_, _, err := sqlspanner.StripHints("SELECT a FROM t@{FORCE_INDEX} WHERE b = ?")
+		Expect(err).ToNot(BeNil())
+	})
+})
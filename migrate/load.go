@@ -0,0 +1,119 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package migrate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/tcncloud/sqlspanner"
+)
+
+// NNN_name.up.sql or NNN_name.down.sql
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// LoadDir reads the migrations in dir, see Load
+func LoadDir(dir string) ([]*Migration, error) {
+	return Load(os.DirFS(dir))
+}
+
+// Load reads the migrations in the root of fsys, sorted by version. Each migration
+// is a NNN_name.up.sql file of statements separated by semicolons, and an optional
+// NNN_name.down.sql file that undoes it. Other files are ignored
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		matches := fileRegexp.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid version: %v", entry.Name(), err)
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = mig
+		}
+		if mig.Name != matches[2] {
+			return nil, fmt.Errorf("%s: migration %d is already named %s", entry.Name(), version, mig.Name)
+		}
+		script, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, err
+		}
+		statements, err := splitScript(string(script))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+		if matches[3] == "up" {
+			if mig.Up != nil {
+				return nil, fmt.Errorf("%s: there is more than one up migration %d", entry.Name(), version)
+			}
+			mig.Up = statements
+		} else {
+			if mig.Down != nil {
+				return nil, fmt.Errorf("%s: there is more than one down migration %d", entry.Name(), version)
+			}
+			mig.Down = statements
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == nil {
+			return nil, fmt.Errorf("migration %s has a down migration, but no up migration", mig)
+		}
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// the statements in a script, the last one does not need a semicolon. The
+// statements are never nil, so an empty down migration can be told from a missing one
+func splitScript(script string) ([]string, error) {
+	statements, rest := sqlspanner.SplitStatements(script)
+	last, rest := sqlspanner.SplitStatements(rest + ";")
+	if strings.TrimSpace(rest) != "" {
+		return nil, fmt.Errorf("unterminated string or comment: %s", strings.TrimSpace(rest))
+	}
+	return append(append([]string{}, statements...), last...), nil
+}
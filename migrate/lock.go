@@ -0,0 +1,206 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+)
+
+// the id of the lock's row in the lock table
+const lockID = 1
+
+// how often a migrator waiting for the lock checks if it has been released
+var lockPollInterval = time.Second
+
+// LockedError is returned when another migrator held the lock for longer than LockTimeout
+type LockedError struct {
+	Owner     string
+	ExpiresAt time.Time
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("migrations are locked by %s until %s", e.Owner, e.ExpiresAt.Format(time.RFC3339))
+}
+
+func (m *Migrator) lockTable() string {
+	return m.Table + "Lock"
+}
+
+// a held lock, renewed until it is unlocked
+type lease struct {
+	m    *Migrator
+	stop chan struct{}
+	done chan struct{}
+
+	mu      sync.Mutex
+	lostErr error
+}
+
+// waits for the lock, and renews it in the background until it is unlocked
+func (m *Migrator) lock(ctx context.Context, conn *sql.Conn) (*lease, error) {
+	deadline := time.Now().Add(m.LockTimeout)
+	for {
+		owner, expiresAt, err := m.lockHolder(ctx, conn)
+		switch {
+		case err == sql.ErrNoRows:
+			// no one holds the lock, inserting it fails if another migrator takes it first
+			err = sqlspanner.WriteMutations(ctx, conn, spanner.Insert(m.lockTable(),
+				[]string{"Id", "Owner", "ExpiresAt"},
+				[]interface{}{lockID, m.Owner, time.Now().Add(m.Lease)},
+			))
+			if err == nil {
+				return m.renewLease(), nil
+			}
+			if !sqlspanner.IsAlreadyExists(err) {
+				return nil, err
+			}
+		case err != nil:
+			return nil, err
+		case owner == m.Owner || time.Now().After(expiresAt):
+			// an expired lock is taken over, as long as no one else took it first
+			counts, err := execDML(ctx, conn, dmlStatement{
+				query: fmt.Sprintf("UPDATE %s SET Owner = ?, ExpiresAt = ? WHERE Id = ? AND Owner = ? AND ExpiresAt = ?", m.lockTable()),
+				args:  []interface{}{m.Owner, time.Now().Add(m.Lease), lockID, owner, expiresAt},
+			})
+			if err != nil {
+				return nil, err
+			}
+			if counts[0] == 1 {
+				return m.renewLease(), nil
+			}
+		case time.Now().After(deadline):
+			return nil, &LockedError{Owner: owner, ExpiresAt: expiresAt}
+		default:
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(lockPollInterval):
+			}
+		}
+	}
+}
+
+// who holds the lock, and when it expires, or sql.ErrNoRows when no one does
+func (m *Migrator) lockHolder(ctx context.Context, conn *sql.Conn) (string, time.Time, error) {
+	var owner string
+	var expiresAt time.Time
+	query := fmt.Sprintf("SELECT Owner, ExpiresAt FROM %s WHERE Id = %d", m.lockTable(), lockID)
+	err := conn.QueryRowContext(ctx, query).Scan(&owner, &expiresAt)
+	return owner, expiresAt, err
+}
+
+func (m *Migrator) renewLease() *lease {
+	l := &lease{m: m, stop: make(chan struct{}), done: make(chan struct{})}
+	go l.renew()
+	return l
+}
+
+// extends the lease every third of its length, until it is stopped or taken over
+func (l *lease) renew() {
+	defer close(l.done)
+	expiresAt := time.Now().Add(l.m.Lease)
+	ticker := time.NewTicker(l.m.Lease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		next := time.Now().Add(l.m.Lease)
+		counts, err := l.extend(next)
+		switch {
+		case err == nil && counts[0] == 1:
+			expiresAt = next
+		case err == nil:
+			l.setLost(fmt.Errorf("another migrator took over the migration lock"))
+			return
+		case time.Now().After(expiresAt):
+			l.setLost(fmt.Errorf("the migration lock expired, it could not be renewed: %w", err))
+			return
+		}
+	}
+}
+
+func (l *lease) extend(expiresAt time.Time) ([]int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), l.m.Lease/3)
+	defer cancel()
+	conn, err := l.m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return execDML(ctx, conn, dmlStatement{
+		query: fmt.Sprintf("UPDATE %s SET ExpiresAt = ? WHERE Id = ? AND Owner = ?", l.m.lockTable()),
+		args:  []interface{}{expiresAt, lockID, l.m.Owner},
+	})
+}
+
+func (l *lease) setLost(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lostErr = err
+}
+
+// the reason the lock was lost, or nil while it is held
+func (l *lease) lost() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lostErr
+}
+
+// stops renewing the lease, and releases the lock if it is still held
+func (l *lease) unlock(ctx context.Context, conn *sql.Conn) error {
+	close(l.stop)
+	<-l.done
+	if err := l.lost(); err != nil {
+		return err
+	}
+	owner, _, err := l.m.lockHolder(ctx, conn)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if owner != l.m.Owner {
+		return fmt.Errorf("another migrator took over the migration lock")
+	}
+	// the lease was renewed, so it cannot expire and be taken over before it is deleted
+	return sqlspanner.WriteMutations(ctx, conn, spanner.Delete(l.m.lockTable(), spanner.Key{int64(lockID)}))
+}
@@ -0,0 +1,461 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package migrate applies numbered schema and data migrations to a spanner database
+// through the sqlspanner driver. Migrations are read from files named like
+//   001_create_users.up.sql
+//   001_create_users.down.sql
+// applied in order of their version, and recorded in a SchemaMigrations table.
+// A migration has either DDL or DML statements, spanner cannot change a schema in a
+// transaction, so a migration mixing them could be left half applied. Consecutive DDL
+// migrations are sent to spanner as one schema change, and recorded once it is done.
+// Consecutive DML migrations run in one transaction, along with recording them. A lease on a lock row keeps migrators deploying at the same time from
+// running migrations over each other
+//   migrations, err := migrate.LoadDir("migrations")
+//   err = migrate.New(db, migrations).Up(ctx)
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"google.golang.org/grpc/codes"
+)
+
+// Migration is a numbered change to a database, and the statements that undo it
+type Migration struct {
+	Version int64
+	Name    string
+	// the statements that apply the migration
+	Up []string
+	// the statements that undo the migration, nil when it cannot be undone
+	Down []string
+}
+
+func (m *Migration) String() string {
+	return fmt.Sprintf("%d_%s", m.Version, m.Name)
+}
+
+// Migrator applies and rolls back migrations on a database
+type Migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+	// runs the statements of a DML step, and the ones recording it, in one transaction
+	execDML func(ctx context.Context, conn *sql.Conn, statements ...dmlStatement) ([]int64, error)
+
+	// Table is the table applied migrations are recorded in, SchemaMigrations by default.
+	// The lock is a row in a table named Table + "Lock". Both are created when they
+	// do not exist
+	Table string
+	// Owner identifies the migrator in the lock, by default the host name, process id,
+	// and the time the migrator was made
+	Owner string
+	// Lease is how long the lock is held without being renewed, a minute by default.
+	// It is renewed while migrations run, and taken over by other migrators when it expires
+	Lease time.Duration
+	// LockTimeout is how long to wait for another migrator to release the lock,
+	// five minutes by default
+	LockTimeout time.Duration
+	// Log is told about each step as it runs, when it is set
+	Log io.Writer
+}
+
+// New returns a Migrator that applies migrations to db, they are sorted by version
+func New(db *sql.DB, migrations []*Migration) *Migrator {
+	sorted := make([]*Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	host, _ := os.Hostname()
+	return &Migrator{
+		db:          db,
+		migrations:  sorted,
+		execDML:     execDML,
+		Table:       "SchemaMigrations",
+		Owner:       fmt.Sprintf("%s/%d/%d", host, os.Getpid(), time.Now().UnixNano()),
+		Lease:       time.Minute,
+		LockTimeout: 5 * time.Minute,
+	}
+}
+
+// Applied returns the versions of the migrations that have been applied, in order.
+// It only reads the database, nothing has been applied when the Table does not exist
+func (m *Migrator) Applied(ctx context.Context) ([]int64, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	exists, err := tableExists(ctx, conn, m.Table)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []int64{}, nil
+	}
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	versions := make([]int64, 0, len(applied))
+	for v := range applied {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions, nil
+}
+
+// Up applies every migration that has not been applied
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.UpTo(ctx, math.MaxInt64)
+}
+
+// UpTo applies the migrations that have not been applied, up to and including version.
+// Migrations are applied in order, one older than the last applied migration is an error
+func (m *Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.run(ctx, func(applied map[int64]bool) ([]*step, error) {
+		var last int64
+		for v := range applied {
+			if v > last {
+				last = v
+			}
+		}
+		var pending []*Migration
+		for _, mig := range m.migrations {
+			if mig.Version > version || applied[mig.Version] {
+				continue
+			}
+			if mig.Version < last {
+				return nil, fmt.Errorf("migration %s has not been applied, but the later migration %d has", mig, last)
+			}
+			pending = append(pending, mig)
+		}
+		return plan(pending, false)
+	})
+}
+
+// DownTo rolls back the applied migrations newer than version, newest first. DownTo(ctx, 0)
+// rolls back every migration
+func (m *Migrator) DownTo(ctx context.Context, version int64) error {
+	return m.run(ctx, func(applied map[int64]bool) ([]*step, error) {
+		var rollback []*Migration
+		byVersion := make(map[int64]*Migration, len(m.migrations))
+		for _, mig := range m.migrations {
+			byVersion[mig.Version] = mig
+		}
+		var versions []int64
+		for v := range applied {
+			if v > version {
+				versions = append(versions, v)
+			}
+		}
+		sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+		for _, v := range versions {
+			mig, ok := byVersion[v]
+			if !ok {
+				return nil, fmt.Errorf("migration %d has been applied, but there is no file for it", v)
+			}
+			if mig.Down == nil {
+				return nil, fmt.Errorf("migration %s cannot be rolled back, it has no down migration", mig)
+			}
+			rollback = append(rollback, mig)
+		}
+		return plan(rollback, true)
+	})
+}
+
+// a group of statements run together, and the migrations recorded as applied, or
+// removed when rolling back, when they succeed
+type step struct {
+	ddl        bool
+	statements []string
+	done       []*Migration
+	down       bool
+}
+
+// groups the migrations into steps, consecutive DDL migrations are one schema
+// change, and consecutive DML migrations one transaction. A migration mixing DDL
+// and DML is an error, its DDL would be applied before it could be recorded
+func plan(migrations []*Migration, down bool) ([]*step, error) {
+	var steps []*step
+	for _, mig := range migrations {
+		statements := mig.Up
+		if down {
+			statements = mig.Down
+		}
+		// migrations without statements are recorded with the previous step
+		if len(statements) == 0 {
+			if len(steps) == 0 {
+				steps = append(steps, &step{down: down})
+			}
+			last := steps[len(steps)-1]
+			last.done = append(last.done, mig)
+			continue
+		}
+		ddl := sqlspanner.IsDDL(statements[0])
+		for _, stmt := range statements[1:] {
+			if sqlspanner.IsDDL(stmt) != ddl {
+				return nil, fmt.Errorf("migration %s mixes DDL and DML statements, split it into a DDL and a DML migration", mig)
+			}
+		}
+		if len(steps) == 0 || steps[len(steps)-1].ddl != ddl {
+			steps = append(steps, &step{ddl: ddl, down: down})
+		}
+		last := steps[len(steps)-1]
+		last.statements = append(last.statements, statements...)
+		last.done = append(last.done, mig)
+	}
+	return steps, nil
+}
+
+func (s *step) String() string {
+	kind := "DML"
+	if s.ddl {
+		kind = "DDL"
+	}
+	action := "applying"
+	if s.down {
+		action = "rolling back"
+	}
+	return fmt.Sprintf("%s %v, %d %s statements", action, s.done, len(s.statements), kind)
+}
+
+// locks the database, and runs the steps planned from the applied migrations
+func (m *Migrator) run(ctx context.Context, planSteps func(applied map[int64]bool) ([]*step, error)) (err error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := m.createTables(ctx, conn); err != nil {
+		return err
+	}
+	l, err := m.lock(ctx, conn)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if unlockErr := l.unlock(ctx, conn); err == nil {
+			err = unlockErr
+		}
+	}()
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+	steps, err := planSteps(applied)
+	if err != nil {
+		return err
+	}
+	for _, s := range steps {
+		// spanner cannot stop a schema change, so the lease is only checked between steps
+		if err := l.lost(); err != nil {
+			return err
+		}
+		if m.Log != nil {
+			fmt.Fprintln(m.Log, s)
+		}
+		if err := m.runStep(ctx, conn, s); err != nil {
+			return fmt.Errorf("%s: %w", s, err)
+		}
+	}
+	return nil
+}
+
+func (m *Migrator) runStep(ctx context.Context, conn *sql.Conn, s *step) error {
+	records, muts := m.records(s)
+	if !s.ddl {
+		// the migrations are recorded in the same transaction as their statements
+		dml := make([]dmlStatement, 0, len(s.statements)+len(records))
+		for _, stmt := range s.statements {
+			dml = append(dml, dmlStatement{query: stmt})
+		}
+		_, err := m.execDML(ctx, conn, append(dml, records...)...)
+		return err
+	}
+	err := conn.Raw(func(dc interface{}) error {
+		return dc.(sqlspanner.SpannerConn).StartBatchDDL()
+	})
+	if err != nil {
+		return err
+	}
+	for _, stmt := range s.statements {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			abortBatch(conn)
+			return err
+		}
+	}
+	err = conn.Raw(func(dc interface{}) error {
+		_, err := dc.(sqlspanner.SpannerConn).RunBatch(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	// spanner does not change schemas in transactions, the migrations are recorded
+	// once the schema change is done
+	return sqlspanner.WriteMutations(ctx, conn, muts...)
+}
+
+// records the step's migrations as applied, or removes them when rolling back, as
+// the statements a DML step runs in its transaction, and the same writes as the
+// mutations a DDL step applies after its schema change. Either way recording a
+// migration that was already recorded fails
+func (m *Migrator) records(s *step) ([]dmlStatement, []*spanner.Mutation) {
+	statements := make([]dmlStatement, len(s.done))
+	muts := make([]*spanner.Mutation, len(s.done))
+	for i, mig := range s.done {
+		if s.down {
+			statements[i] = dmlStatement{query: fmt.Sprintf("DELETE FROM %s WHERE Version = ?", m.Table), args: []interface{}{mig.Version}}
+			muts[i] = spanner.Delete(m.Table, spanner.Key{mig.Version})
+			continue
+		}
+		values := []interface{}{mig.Version, mig.Name, time.Now()}
+		statements[i] = dmlStatement{query: fmt.Sprintf("INSERT INTO %s (Version, Name, AppliedAt) VALUES (?, ?, ?)", m.Table), args: values}
+		muts[i] = spanner.Insert(m.Table, []string{"Version", "Name", "AppliedAt"}, values)
+	}
+	return statements, muts
+}
+
+type dmlStatement struct {
+	query string
+	args  []interface{}
+}
+
+// runs the statements as a DML batch, in one transaction, and returns the rows each changed
+func execDML(ctx context.Context, conn *sql.Conn, statements ...dmlStatement) ([]int64, error) {
+	err := conn.Raw(func(dc interface{}) error {
+		return dc.(sqlspanner.SpannerConn).StartBatchDML()
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, stmt := range statements {
+		if _, err := conn.ExecContext(ctx, stmt.query, stmt.args...); err != nil {
+			abortBatch(conn)
+			return nil, err
+		}
+	}
+	var counts []int64
+	err = conn.Raw(func(dc interface{}) error {
+		counts, err = dc.(sqlspanner.SpannerConn).RunBatch(ctx)
+		return err
+	})
+	return counts, err
+}
+
+func abortBatch(conn *sql.Conn) {
+	conn.Raw(func(dc interface{}) error {
+		return dc.(sqlspanner.SpannerConn).AbortBatch()
+	})
+}
+
+// creates the migrations and lock tables when they do not exist
+func (m *Migrator) createTables(ctx context.Context, conn *sql.Conn) error {
+	tables := []struct {
+		name string
+		ddl  string
+	}{
+		{m.Table, fmt.Sprintf(`CREATE TABLE %s (
+	Version INT64 NOT NULL,
+	Name STRING(MAX) NOT NULL,
+	AppliedAt TIMESTAMP NOT NULL
+) PRIMARY KEY (Version)`, m.Table)},
+		{m.lockTable(), fmt.Sprintf(`CREATE TABLE %s (
+	Id INT64 NOT NULL,
+	Owner STRING(MAX) NOT NULL,
+	ExpiresAt TIMESTAMP NOT NULL
+) PRIMARY KEY (Id)`, m.lockTable())},
+	}
+	for _, t := range tables {
+		exists, err := tableExists(ctx, conn, t.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, t.ddl); err != nil {
+			// another migrator may have created it first
+			if exists, _ := tableExists(ctx, conn, t.name); exists {
+				continue
+			}
+			return fmt.Errorf("creating %s: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+func tableExists(ctx context.Context, conn *sql.Conn, table string) (bool, error) {
+	hasSchema, err := sqlspanner.HasInformationSchema(conn)
+	if err != nil {
+		return false, err
+	}
+	if !hasSchema {
+		// the fake reports a missing table as not found
+		var one int64
+		err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", table)).Scan(&one)
+		switch {
+		case err == nil, err == sql.ErrNoRows:
+			return true, nil
+		case sqlspanner.ErrorCode(err) == codes.NotFound:
+			return false, nil
+		}
+		return false, err
+	}
+	var count int64
+	err = conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ?", table).Scan(&count)
+	return count > 0, err
+}
+
+// the versions of the applied migrations
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT Version FROM %s", m.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var v int64
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		applied[v] = true
+	}
+	return applied, rows.Err()
+}
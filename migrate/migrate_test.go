@@ -0,0 +1,307 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package migrate_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing/fstest"
+	"time"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"github.com/tcncloud/sqlspanner/fake"
+	"github.com/tcncloud/sqlspanner/migrate"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load", func() {
+	It("reads migrations sorted by version", func() {
+		migrations, err := migrate.Load(fstest.MapFS{
+			"002_add_email.up.sql":      {Data: []byte("ALTER TABLE users ADD COLUMN email STRING(MAX);\n")},
+			"002_add_email.down.sql":    {Data: []byte("-- nothing to undo\n")},
+			"001_create_users.up.sql":   {Data: []byte("CREATE TABLE users (id INT64 NOT NULL) PRIMARY KEY (id);\nCREATE INDEX users_by_id ON users (id)")},
+			"001_create_users.down.sql": {Data: []byte("DROP INDEX users_by_id; DROP TABLE users;")},
+			"003_seed.up.sql":           {Data: []byte("INSERT INTO users (id) VALUES (1);")},
+			"README.md":                 {Data: []byte("not a migration")},
+		})
+		Expect(err).To(BeNil())
+		Expect(migrations).To(HaveLen(3))
+		Expect(migrations[0]).To(Equal(&migrate.Migration{
+			Version: 1,
+			Name:    "create_users",
+			Up:      []string{"CREATE TABLE users (id INT64 NOT NULL) PRIMARY KEY (id)", "CREATE INDEX users_by_id ON users (id)"},
+			Down:    []string{"DROP INDEX users_by_id", "DROP TABLE users"},
+		}))
+		// an empty down migration can be rolled back, a missing one cannot
+		Expect(migrations[1].Down).To(Equal([]string{}))
+		Expect(migrations[2].Down).To(BeNil())
+	})
+
+	It("rejects down migrations without an up migration", func() {
+		_, err := migrate.Load(fstest.MapFS{"001_a.down.sql": {Data: []byte("DROP TABLE a")}})
+		Expect(err).To(MatchError(ContainSubstring("no up migration")))
+	})
+
+	It("rejects unterminated strings", func() {
+		_, err := migrate.Load(fstest.MapFS{"001_a.up.sql": {Data: []byte("INSERT INTO a (s) VALUES ('x);")}})
+		Expect(err).To(MatchError(ContainSubstring("unterminated")))
+	})
+})
+
+var _ = Describe("planning", func() {
+	It("runs spanner's other schema statements as DDL", func() {
+		Expect(migrate.Steps([]*migrate.Migration{{
+			Version: 1,
+			Name:    "schema",
+			Up: []string{
+				"CREATE CHANGE STREAM users_stream FOR users",
+				"CREATE VIEW active_users SQL SECURITY INVOKER AS SELECT id FROM users",
+				"ALTER DATABASE db SET OPTIONS (version_retention_period = '7d')",
+				"CREATE SEQUENCE ids OPTIONS (sequence_kind = 'bit_reversed_positive')",
+				"GRANT SELECT ON TABLE users TO ROLE reader",
+			},
+		}}, false)).To(Equal([]string{"applying [1_schema], 5 DDL statements"}))
+	})
+
+	It("groups consecutive DDL migrations, and consecutive DML migrations", func() {
+		Expect(migrate.Steps([]*migrate.Migration{
+			{Version: 1, Name: "a", Up: []string{"CREATE TABLE a (id INT64) PRIMARY KEY (id)"}},
+			{Version: 2, Name: "b", Up: []string{"INSERT INTO a (id) VALUES (1)"}},
+			{Version: 3, Name: "c", Up: []string{"UPDATE a SET id = 2 WHERE id = 1"}},
+			{Version: 4, Name: "d", Up: []string{}},
+			{Version: 5, Name: "e", Up: []string{"CREATE INDEX a_by_id ON a (id)"}},
+		}, false)).To(Equal([]string{
+			"applying [1_a], 1 DDL statements",
+			"applying [2_b 3_c 4_d], 2 DML statements",
+			"applying [5_e], 1 DDL statements",
+		}))
+	})
+
+	It("rejects migrations that mix DDL and DML", func() {
+		_, err := migrate.Steps([]*migrate.Migration{
+			{Version: 1, Name: "a", Up: []string{"CREATE TABLE a (id INT64) PRIMARY KEY (id)", "INSERT INTO a (id) VALUES (1)"}},
+		}, false)
+		Expect(err).To(MatchError(ContainSubstring("migration 1_a mixes DDL and DML statements")))
+	})
+})
+
+var _ = Describe("Migrator", func() {
+	var (
+		ctx    context.Context
+		fakeDB *fake.Database
+		db     *sql.DB
+	)
+
+	createUsers := &migrate.Migration{
+		Version: 1,
+		Name:    "create_users",
+		Up:      []string{"CREATE TABLE users (id INT64 NOT NULL, name STRING(MAX)) PRIMARY KEY (id)"},
+		Down:    []string{"DROP TABLE users"},
+	}
+	createTeams := &migrate.Migration{
+		Version: 2,
+		Name:    "create_teams",
+		Up:      []string{"CREATE TABLE teams (id INT64 NOT NULL) PRIMARY KEY (id)"},
+		Down:    []string{"DROP TABLE teams"},
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		fakeDB, db, err = fake.Open("migrate_test")
+		Expect(err).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(fakeDB.Close()).To(BeNil())
+	})
+
+	tableExists := func(table string) bool {
+		rows, err := db.QueryContext(ctx, "SELECT 1 FROM "+table)
+		if err != nil {
+			return false
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return rows.Err() == nil
+	}
+
+	It("applies pending migrations, batching consecutive DDL", func() {
+		var log bytes.Buffer
+		m := migrate.New(db, []*migrate.Migration{createTeams, createUsers})
+		m.Log = &log
+		Expect(m.Up(ctx)).To(BeNil())
+		Expect(tableExists("users")).To(BeTrue())
+		Expect(tableExists("teams")).To(BeTrue())
+		Expect(strings.Count(log.String(), "\n")).To(Equal(1))
+		Expect(log.String()).To(ContainSubstring("2 DDL statements"))
+		Expect(m.Applied(ctx)).To(Equal([]int64{1, 2}))
+
+		// the lock is released, and there is nothing left to apply
+		log.Reset()
+		Expect(m.Up(ctx)).To(BeNil())
+		Expect(log.String()).To(BeEmpty())
+	})
+
+	It("applies DDL statements that start with a comment", func() {
+		migrations, err := migrate.Load(fstest.MapFS{
+			"001_create_users.up.sql": {Data: []byte("-- the users\nCREATE TABLE users (id INT64 NOT NULL) PRIMARY KEY (id);\n/* v2 */ CREATE INDEX users_by_id ON users (id);\n")},
+		})
+		Expect(err).To(BeNil())
+		Expect(migrate.Steps(migrations, false)).To(Equal([]string{"applying [1_create_users], 2 DDL statements"}))
+		Expect(migrate.New(db, migrations).Up(ctx)).To(BeNil())
+		Expect(tableExists("users")).To(BeTrue())
+	})
+
+	It("applies migrations up to a version, and rolls them back", func() {
+		m := migrate.New(db, []*migrate.Migration{createUsers, createTeams})
+		Expect(m.UpTo(ctx, 1)).To(BeNil())
+		Expect(m.Applied(ctx)).To(Equal([]int64{1}))
+		Expect(tableExists("teams")).To(BeFalse())
+		Expect(m.Up(ctx)).To(BeNil())
+		Expect(m.DownTo(ctx, 1)).To(BeNil())
+		Expect(m.Applied(ctx)).To(Equal([]int64{1}))
+		Expect(tableExists("teams")).To(BeFalse())
+		Expect(m.DownTo(ctx, 0)).To(BeNil())
+		Expect(m.Applied(ctx)).To(BeEmpty())
+		Expect(tableExists("users")).To(BeFalse())
+	})
+
+	It("lists nothing applied, without creating its tables", func() {
+		readOnly, err := sql.Open("spanner", fakeDB.DSN()+"?readOnly=true")
+		Expect(err).To(BeNil())
+		defer readOnly.Close()
+		Expect(migrate.New(readOnly, []*migrate.Migration{createUsers}).Applied(ctx)).To(BeEmpty())
+		Expect(tableExists("SchemaMigrations")).To(BeFalse())
+		Expect(tableExists("SchemaMigrationsLock")).To(BeFalse())
+	})
+
+	Describe("DML steps", func() {
+		seed := &migrate.Migration{
+			Version: 2,
+			Name:    "seed",
+			Up:      []string{"INSERT INTO users (id, name) VALUES (1, 'a')", "UPDATE users SET name = 'b' WHERE id = 1"},
+			Down:    []string{"DELETE FROM users WHERE id = 1"},
+		}
+		var batches [][]string
+		var batchArgs [][][]interface{}
+		record := func(queries []string, args [][]interface{}) error {
+			batches = append(batches, queries)
+			batchArgs = append(batchArgs, args)
+			return nil
+		}
+		BeforeEach(func() {
+			batches, batchArgs = nil, nil
+		})
+
+		It("records the migrations in the transaction of their statements", func() {
+			m := migrate.New(db, []*migrate.Migration{createUsers, seed})
+			m.RecordDML(record)
+			Expect(m.Up(ctx)).To(BeNil())
+			Expect(batches).To(Equal([][]string{{
+				"INSERT INTO users (id, name) VALUES (1, 'a')",
+				"UPDATE users SET name = 'b' WHERE id = 1",
+				"INSERT INTO SchemaMigrations (Version, Name, AppliedAt) VALUES (?, ?, ?)",
+			}}))
+			Expect(batchArgs[0][2][:2]).To(Equal([]interface{}{int64(2), "seed"}))
+			// the recorded batch did not run, only the DDL migration was applied
+			Expect(m.Applied(ctx)).To(Equal([]int64{1}))
+		})
+
+		It("removes rolled back migrations in the transaction of their statements", func() {
+			m := migrate.New(db, []*migrate.Migration{createUsers, seed})
+			m.RecordDML(record)
+			Expect(m.UpTo(ctx, 1)).To(BeNil())
+			conn, err := db.Conn(ctx)
+			Expect(err).To(BeNil())
+			defer conn.Close()
+			Expect(sqlspanner.WriteMutations(ctx, conn, spanner.Insert("SchemaMigrations",
+				[]string{"Version", "Name", "AppliedAt"}, []interface{}{int64(2), "seed", time.Now()},
+			))).To(BeNil())
+			Expect(m.DownTo(ctx, 1)).To(BeNil())
+			Expect(batches).To(Equal([][]string{{
+				"DELETE FROM users WHERE id = 1",
+				"DELETE FROM SchemaMigrations WHERE Version = ?",
+			}}))
+			Expect(batchArgs[0][1]).To(Equal([]interface{}{int64(2)}))
+		})
+
+		It("does not record migrations whose statements fail", func() {
+			m := migrate.New(db, []*migrate.Migration{createUsers, seed})
+			m.RecordDML(func([]string, [][]interface{}) error { return errors.New("constraint violated") })
+			err := m.Up(ctx)
+			Expect(err).To(MatchError(ContainSubstring("applying [2_seed], 2 DML statements: constraint violated")))
+			Expect(m.Applied(ctx)).To(Equal([]int64{1}))
+		})
+	})
+
+	It("applies nothing when a pending migration mixes DDL and DML", func() {
+		mixed := &migrate.Migration{Version: 2, Name: "mixed", Up: []string{"CREATE TABLE teams (id INT64 NOT NULL) PRIMARY KEY (id)", "INSERT INTO teams (id) VALUES (1)"}}
+		err := migrate.New(db, []*migrate.Migration{createUsers, mixed}).Up(ctx)
+		Expect(err).To(MatchError(ContainSubstring("2_mixed mixes DDL and DML")))
+		Expect(tableExists("users")).To(BeFalse())
+		Expect(tableExists("teams")).To(BeFalse())
+	})
+
+	It("does not apply migrations older than the last applied one", func() {
+		Expect(migrate.New(db, []*migrate.Migration{createTeams}).Up(ctx)).To(BeNil())
+		err := migrate.New(db, []*migrate.Migration{createUsers, createTeams}).Up(ctx)
+		Expect(err).To(MatchError(ContainSubstring("1_create_users has not been applied")))
+	})
+
+	It("waits for the lock held by another migrator", func() {
+		// creates the tables
+		Expect(migrate.New(db, nil).Up(ctx)).To(BeNil())
+		m := migrate.New(db, []*migrate.Migration{createUsers})
+		m.LockTimeout = 0
+		expiresAt := time.Now().Add(time.Minute).UTC().Truncate(time.Microsecond)
+		conn, err := db.Conn(ctx)
+		Expect(err).To(BeNil())
+		defer conn.Close()
+		Expect(sqlspanner.WriteMutations(ctx, conn, spanner.Insert("SchemaMigrationsLock",
+			[]string{"Id", "Owner", "ExpiresAt"},
+			[]interface{}{1, "deployer-2", expiresAt},
+		))).To(BeNil())
+
+		err = m.Up(ctx)
+		Expect(err).To(BeAssignableToTypeOf(&migrate.LockedError{}))
+		Expect(err.(*migrate.LockedError).Owner).To(Equal("deployer-2"))
+		Expect(err.(*migrate.LockedError).ExpiresAt.Equal(expiresAt)).To(BeTrue())
+		Expect(tableExists("users")).To(BeFalse())
+	})
+})
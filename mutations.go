@@ -0,0 +1,150 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/spanner"
+)
+
+// writes the mutations in the connection's transaction, or applies them when there isn't one.
+// The commit timestamp is nil for buffered writes, they are committed with the transaction,
+// and for writes that are only planned in dry run mode
+func (c *conn) write(ctx context.Context, writes ...*PlannedWrite) (*time.Time, error) {
+	if c.planWrites(writes...) {
+		return nil, nil
+	}
+	muts := make([]*spanner.Mutation, len(writes))
+	for i, w := range writes {
+		muts[i] = w.Mutation
+	}
+	if c.tx != nil {
+		c.tx.mutations = append(c.tx.mutations, muts...)
+		return nil, nil
+	}
+	commitTimestamp, err := c.client.Apply(ctx, muts)
+	if err != nil {
+		return nil, spannerError(err)
+	}
+	c.commitTimestamp = &commitTimestamp
+	return &commitTimestamp, nil
+}
+
+func (c *conn) WriteMutations(ctx context.Context, muts ...*spanner.Mutation) error {
+	if c.cfg.ReadOnly {
+		return &ReadOnlyError{Statement: "mutations"}
+	}
+	if c.batch != nil {
+		return fmt.Errorf("cannot write mutations while a batch is running")
+	}
+	if len(muts) == 0 {
+		return nil
+	}
+	if !c.cfg.AllowUnboundedWrites {
+		for _, m := range muts {
+			if table, ok := unboundedDelete(m); ok {
+				return &UnboundedWriteError{Statement: "DELETE mutation", Table: table}
+			}
+		}
+	}
+	c.commitTimestamp = nil
+	c.planned = nil
+	writes := make([]*PlannedWrite, len(muts))
+	for i, m := range muts {
+		writes[i] = &PlannedWrite{Op: "MUTATION", Mutation: m}
+	}
+	_, err := c.write(ctx, writes...)
+	return err
+}
+
+var (
+	allKeysType  = reflect.TypeOf(spanner.AllKeys())
+	keySetsType  = reflect.TypeOf(spanner.KeySets())
+	keyRangeType = reflect.TypeOf(spanner.KeyRange{})
+)
+
+// reports the table of a Delete mutation whose keys may include every row of it.
+// spanner.Mutation does not export its keys, so they are read with reflect
+func unboundedDelete(m *spanner.Mutation) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	v := reflect.ValueOf(m).Elem()
+	keys := v.FieldByName("keySet")
+	// only deletes have keys
+	if !keys.IsValid() || keys.IsNil() {
+		return "", false
+	}
+	return v.FieldByName("table").String(), unboundedKeys(keys.Elem())
+}
+
+// AllKeys, and key ranges that are missing their start or end are unbounded
+func unboundedKeys(keys reflect.Value) bool {
+	switch keys.Type() {
+	case allKeysType:
+		return true
+	case keyRangeType:
+		return keys.FieldByName("Start").Len() == 0 || keys.FieldByName("End").Len() == 0
+	case keySetsType:
+		for i := 0; i < keys.Len(); i++ {
+			if k := keys.Index(i); !k.IsNil() && unboundedKeys(k.Elem()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteMutations writes mutations built with the spanner package, like
+// spanner.InsertStruct, spanner.InsertOrUpdateMap, or spanner.Delete with a
+// spanner.KeyRange, on c. When a transaction was begun on c they are buffered
+// and applied when it commits, otherwise they are applied immediately. Deletes of
+// spanner.AllKeys, or of key ranges without a start or end, are rejected with an
+// *UnboundedWriteError unless the connection allows unbounded writes:
+//   conn, _ := db.Conn(ctx)
+//   tx, _ := conn.BeginTx(ctx, nil)
+//   err := sqlspanner.WriteMutations(ctx, conn, spanner.InsertOrUpdateMap("users", user))
+//   ...
+//   err = tx.Commit()
+func WriteMutations(ctx context.Context, c *sql.Conn, muts ...*spanner.Mutation) error {
+	return c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a spanner connection: %T", driverConn)
+		}
+		return sc.WriteMutations(ctx, muts...)
+	})
+}
@@ -0,0 +1,140 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"context"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mutations", func() {
+	var ctx context.Context
+	BeforeEach(func() {
+		ctx = context.Background()
+	})
+
+	It("is available through SpannerConn", func() {
+		var sc sqlspanner.SpannerConn = sqlspanner.NewUnconnectedConn()
+		Expect(sc).ToNot(BeNil())
+	})
+
+	Describe("in a transaction", func() {
+		It("buffers mutations until the transaction ends", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			_, err := c.Begin()
+			Expect(err).To(BeNil())
+			err = c.WriteMutations(ctx,
+				spanner.InsertOrUpdateMap("users", map[string]interface{}{"id": 1, "name": "a"}),
+				spanner.Delete("users", spanner.KeyRange{Start: spanner.Key{2}, End: spanner.Key{5}, Kind: spanner.ClosedOpen}),
+			)
+			Expect(err).To(BeNil())
+			Expect(sqlspanner.BufferedMutations(c)).To(HaveLen(2))
+		})
+
+		It("discards the buffered mutations on rollback", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			tx, err := c.Begin()
+			Expect(err).To(BeNil())
+			Expect(c.WriteMutations(ctx, spanner.Delete("users", spanner.Key{1}))).To(BeNil())
+			Expect(tx.Rollback()).To(BeNil())
+			Expect(sqlspanner.BufferedMutations(c)).To(BeNil())
+			_, err = c.Begin()
+			Expect(err).To(BeNil())
+		})
+
+		It("commits nothing when no mutations were buffered", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			tx, err := c.Begin()
+			Expect(err).To(BeNil())
+			Expect(tx.Commit()).To(BeNil())
+			_, err = c.CommitTimestamp()
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("does not allow nested transactions", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			_, err := c.Begin()
+			Expect(err).To(BeNil())
+			_, err = c.Begin()
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("does not allow batches", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			_, err := c.Begin()
+			Expect(err).To(BeNil())
+			Expect(c.StartBatchDML()).ToNot(BeNil())
+		})
+	})
+
+	It("rejects deletes that may remove every row, unless unbounded writes are allowed", func() {
+		unbounded := []spanner.KeySet{
+			spanner.AllKeys(),
+			spanner.KeyRange{Start: spanner.Key{2}, Kind: spanner.ClosedClosed},
+			spanner.KeyRange{End: spanner.Key{5}, Kind: spanner.ClosedOpen},
+			spanner.KeySets(spanner.Key{1}, spanner.AllKeys()),
+		}
+		for _, keys := range unbounded {
+			c := sqlspanner.NewUnconnectedConn()
+			_, err := c.Begin()
+			Expect(err).To(BeNil())
+			err = c.WriteMutations(ctx, spanner.Delete("users", keys))
+			Expect(err).To(MatchError(&sqlspanner.UnboundedWriteError{Statement: "DELETE mutation", Table: "users"}), fmt.Sprintf("%v", keys))
+			Expect(sqlspanner.BufferedMutations(c)).To(BeEmpty())
+
+			c = sqlspanner.NewUnconnectedConnWithConfig(&sqlspanner.Config{AllowUnboundedWrites: true})
+			_, err = c.Begin()
+			Expect(err).To(BeNil())
+			Expect(c.WriteMutations(ctx, spanner.Delete("users", keys))).To(BeNil())
+			Expect(sqlspanner.BufferedMutations(c)).To(HaveLen(1))
+		}
+
+		c := sqlspanner.NewUnconnectedConn()
+		_, err := c.Begin()
+		Expect(err).To(BeNil())
+		Expect(c.WriteMutations(ctx,
+			spanner.Delete("users", spanner.KeySets(spanner.Key{1}, spanner.KeyRange{Start: spanner.Key{2}, End: spanner.Key{5}})),
+			spanner.InsertOrUpdateMap("users", map[string]interface{}{"id": 1, "name": "a"}),
+		)).To(BeNil())
+	})
+
+	It("cannot be written during a batch", func() {
+		c := sqlspanner.NewUnconnectedConn()
+		Expect(c.StartBatchDML()).To(BeNil())
+		Expect(c.WriteMutations(ctx, spanner.Delete("users", spanner.AllKeys()))).ToNot(BeNil())
+	})
+})
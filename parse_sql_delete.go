@@ -58,10 +58,9 @@ import (
 func extractSpannerKeyFromDelete(del *sqlparser.Delete) (*MergableKeyRange, error) {
 	where := del.Where
 	if where == nil {
-		return nil, fmt.Errorf("Must include a where clause that contain primary keys in delete statement")
+		return nil, fmt.Errorf("Must include a where clause that contain primary keys in delete statement, or use the PARTITIONED_NON_ATOMIC autocommit dml mode with allowUnboundedWrites")
 	}
 	myArgs := &Args{}
-	fmt.Printf("where type: %+v\n", where.Type)
 	aKeySet := &AwareKeySet{
 		Args:     myArgs,
 		Keys:     make(map[string]*Key),
@@ -82,6 +81,8 @@ type Key struct {
 	UpperOpen  bool
 	HaveLower  bool
 	HaveUpper  bool
+	InValues   []interface{} // set by an IN list, only used by point lookups
+	Conditions int           // the number of comparisons of the key, a later one overwrites the values of an earlier one
 }
 
 type AwareKeySet struct {
@@ -121,19 +122,19 @@ func (a *AwareKeySet) packKeySet() (*MergableKeyRange, error) {
 	}
 	for _, k := range a.KeyOrder {
 		key := a.Keys[k]
+		if key.InValues != nil {
+			return nil, &UnsupportedSQLError{Construct: "IN comparisons in a range", Statement: "DELETE"}
+		}
 		if prev == nil {
 			prev = &MergableKeyRange{Start: newPartialArgSlice(), End: newPartialArgSlice()}
 			prev.fromKey(key)
 		} else {
-			fmt.Printf("key that will populate prev: %#v\n\n", key)
 			err := prev.mergeKey(key)
-			fmt.Printf("merged prev with m %#v\n\n", prev)
 			if err != nil {
 				return nil, err
 			}
 		}
 	}
-	fmt.Printf("prev: %#v\n\n", prev)
 	return prev, nil
 }
 
@@ -149,6 +150,11 @@ func (k1 *MergableKeyRange) fromKey(key *Key) {
 	k1.End.AddArgs(key.UpperValue)
 }
 
+// a range without a lower or upper bound runs to the start or end of the table
+func (k *MergableKeyRange) bounded() bool {
+	return k != nil && k.HaveLower && k.HaveUpper
+}
+
 func (k *MergableKeyRange) ToKeyRange(args []driver.Value) (*spanner.KeyRange, error) {
 	low := k.LowerOpen
 	up := k.UpperOpen
@@ -180,7 +186,6 @@ func (k *MergableKeyRange) ToKeyRange(args []driver.Value) (*spanner.KeyRange, e
 }
 
 func (k1 *MergableKeyRange) mergeKey(k2 *Key) error {
-	fmt.Printf("\nmerging into k1: %#v\n  k2: %#v\n\n", k1, k2)
 	if k2.HaveLower {
 		if k1.LowerOpen != k2.LowerOpen {
 			return fmt.Errorf("Kinds in ranges must all match")
@@ -202,20 +207,37 @@ func (a *AwareKeySet) addKeyFromValExpr(valExpr sqlparser.ValExpr) (*Key, error)
 		return nil, fmt.Errorf("not a valid column name")
 	}
 	if len(col.Qualifier) != 0 {
-		return nil, fmt.Errorf("qualifiers not allowed")
+		return nil, &UnsupportedSQLError{Construct: "column name qualifiers", Statement: "DELETE"}
 	}
 	keyName := string(col.Name[:])
 	if a.Keys[keyName] == nil {
 		a.KeyOrder = append(a.KeyOrder, keyName)
 		a.Keys[keyName] = &Key{Name: keyName}
 	}
+	a.Keys[keyName].Conditions++
 	return a.Keys[keyName], nil
 }
 
+// the values of an IN list, like: id IN (1, ?, 3)
+func (a *AwareKeySet) parseInList(valExpr sqlparser.ValExpr) ([]interface{}, error) {
+	tuple, ok := valExpr.(sqlparser.ValTuple)
+	if !ok {
+		return nil, fmt.Errorf("in comparisons need a list of values")
+	}
+	vals := make([]interface{}, 0, len(tuple))
+	for _, expr := range tuple {
+		val, err := a.Args.ParseValExpr(expr)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, val)
+	}
+	return vals, nil
+}
+
 func (a *AwareKeySet) walkBoolExpr(boolExpr sqlparser.BoolExpr) error {
 	switch expr := boolExpr.(type) {
 	case *sqlparser.AndExpr:
-		fmt.Printf("AndExpr %#v\n", expr)
 		err := a.walkBoolExpr(expr.Left)
 		if err != nil {
 			return err
@@ -226,21 +248,21 @@ func (a *AwareKeySet) walkBoolExpr(boolExpr sqlparser.BoolExpr) error {
 		}
 		return nil
 	case *sqlparser.OrExpr:
-		fmt.Printf("OrExpr %#v\n", expr)
-		return fmt.Errorf("Or Expressions are not currently supported")
-	case *sqlparser.ParenBoolExpr:
-		fmt.Printf("ParenBoolExpr %#v\n", expr)
+		return &UnsupportedSQLError{Construct: "OR", Statement: "DELETE"}
 	case *sqlparser.ComparisonExpr:
-		fmt.Printf("ComparisonExpr %#v\n", expr)
 		myKey, err := a.addKeyFromValExpr(expr.Left)
 		if err != nil {
 			return err
 		}
-		val, err := a.Args.ParseValExpr(expr.Right)
+		var val interface{}
+		if expr.Operator == "in" {
+			val, err = a.parseInList(expr.Right)
+		} else {
+			val, err = a.Args.ParseValExpr(expr.Right)
+		}
 		if err != nil {
 			return err
 		}
-		fmt.Printf("OPERTATOR %#v\n", expr.Operator)
 		switch expr.Operator {
 		case "=":
 			myKey.LowerValue = val
@@ -271,14 +293,16 @@ func (a *AwareKeySet) walkBoolExpr(boolExpr sqlparser.BoolExpr) error {
 			myKey.HaveUpper = true
 			return nil
 		case "!=":
-			return fmt.Errorf("!= comparisons are not supported")
-		case "not in", "in":
-			return fmt.Errorf("in, and not in  comparisons are not supported")
+			return &UnsupportedSQLError{Construct: "!= comparisons", Statement: "DELETE"}
+		case "in":
+			myKey.InValues = val.([]interface{})
+			return nil
+		case "not in":
+			return &UnsupportedSQLError{Construct: "NOT IN comparisons", Statement: "DELETE"}
 		default:
-			return fmt.Errorf("%#v  is not a supported operator", expr.Operator)
+			return &UnsupportedSQLError{Construct: fmt.Sprintf("%s operator", expr.Operator), Statement: "DELETE"}
 		}
 	case *sqlparser.RangeCond:
-		fmt.Printf("RangeCond %#v\n", expr)
 		myKey, err := a.addKeyFromValExpr(expr.Left)
 		if err != nil {
 			return err
@@ -298,13 +322,10 @@ func (a *AwareKeySet) walkBoolExpr(boolExpr sqlparser.BoolExpr) error {
 			myKey.UpperValue = to
 			myKey.UpperOpen = true
 		case "not between":
-			return fmt.Errorf("not between operator is not supported")
+			return &UnsupportedSQLError{Construct: "NOT BETWEEN", Statement: "DELETE"}
 		}
 	case *sqlparser.ExistsExpr:
-		fmt.Printf("ExistsExpr %#v\n", expr)
-		return fmt.Errorf("Exists Expressions are not supported")
-	default:
-		fmt.Printf("HITTING DEFAULT %#v\n", boolExpr)
+		return &UnsupportedSQLError{Construct: "EXISTS", Statement: "DELETE"}
 	}
 
 	return fmt.Errorf("not a boolexpr %#v\n", boolExpr)
@@ -51,7 +51,7 @@ func extractInsertColumns(insert *sqlparser.Insert) ([]string, error) {
 				"Star:": t,
 				"i:":    i,
 			}).Debug("star expr")
-			return nil, fmt.Errorf("cannot use type: sqlparser.StarExpr in insert query")
+			return nil, &UnsupportedSQLError{Construct: "*", Statement: "INSERT"}
 		case *sqlparser.NonStarExpr:
 			logrus.WithFields(logrus.Fields{
 				"NonStar:": t,
@@ -62,7 +62,7 @@ func extractInsertColumns(insert *sqlparser.Insert) ([]string, error) {
 				return nil, fmt.Errorf("cannot use any other type besides *sqlparser.ColName in insertQuery")
 			}
 			if len(e.Qualifier) != 0 {
-				return nil, fmt.Errorf("cannot use column name qualifiers in insert query")
+				return nil, &UnsupportedSQLError{Construct: "column name qualifiers", Statement: "INSERT"}
 			}
 			colNames[i] = string(e.Name[:])
 		default:
@@ -93,8 +93,7 @@ func extractIUDTableName(st sqlparser.Statement) (string, error) {
 		return "", fmt.Errorf("TableName node cannot be nil")
 	}
 	if len(table.Qualifier) != 0 {
-		fmt.Printf("table qualifier: %s", string(table.Qualifier[:]))
-		return "", fmt.Errorf("Table Name Qualifiers are not supported for insert/update queries")
+		return "", &UnsupportedSQLError{Construct: "table name qualifiers"}
 	}
 	if len(table.Name) == 0 {
 		return "", fmt.Errorf("Table name cannot be empty for insert/update queries")
@@ -116,19 +115,17 @@ func prepareInsertValues(insert *sqlparser.Insert) (*partialArgSlice, error) {
 	rows := insert.Rows
 	switch rowType := rows.(type) {
 	case *sqlparser.Select, *sqlparser.Union:
-		return nil, fmt.Errorf("insert queries must use simple values (No SELECTS, or UNIONs)")
+		return nil, &UnsupportedSQLError{Construct: "SELECT and UNION values", Statement: "INSERT"}
 	case sqlparser.Values:
 		rowTuple := ([]sqlparser.RowTuple)(rowType)
 		if len(rowTuple) != 1 {
-			return nil, fmt.Errorf("Cannot use multiple row tuples for insert queries")
+			return nil, &UnsupportedSQLError{Construct: "multiple rows", Statement: "INSERT"}
 		}
 		rt := rowTuple[0]
 		switch valType := rt.(type) {
 		case *sqlparser.Subquery:
-			return nil, fmt.Errorf("insert queries cannot have subqueries")
+			return nil, &UnsupportedSQLError{Construct: "subqueries", Statement: "INSERT"}
 		case sqlparser.ValTuple: // a number
-			fmt.Printf("is ValTuple %+v\n", valType)
-
 			valExp := sqlparser.ValExprs(valType)
 			valExps := ([]sqlparser.ValExpr)(valExp)
 			partialArgs := newPartialArgSlice()
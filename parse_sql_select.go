@@ -0,0 +1,56 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import "regexp"
+
+// a query, possibly after comments, a statement hint, and opening parentheses
+var selectRegexp = regexp.MustCompile(`(?is)^(?:\s+|--[^\n]*(?:\n|$)|#[^\n]*(?:\n|$)|/\*.*?\*/)*(?:@\{[^}]*\}\s*)?[(\s]*(SELECT|WITH)\b`)
+
+// reports whether the query is a SELECT, or a WITH clause followed by a SELECT.
+// Only the start of the query is checked, so queries the parser cannot
+// understand can still be classified
+func isSelect(query string) bool {
+	return selectRegexp.MatchString(query)
+}
+
+// IsQuery reports whether the driver runs query as a query that returns rows:
+// a SELECT, an EXPLAIN, or a RUN PARTITION. Tools use it to choose between
+// QueryContext and ExecContext
+func IsQuery(query string) bool {
+	if ok, _ := parseRunPartition(query); ok {
+		return true
+	}
+	if mode, _ := explainMode(query); mode != nil {
+		return true
+	}
+	return isSelect(query)
+}
@@ -0,0 +1,121 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"database/sql/driver"
+
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Spanner SQL selects", func() {
+	Describe("classifying queries", func() {
+		It("recognizes selects", func() {
+			Expect(sqlspanner.IsSelect("SELECT 1")).To(BeTrue())
+			Expect(sqlspanner.IsSelect("  select a from t")).To(BeTrue())
+			Expect(sqlspanner.IsSelect("(SELECT a FROM t) UNION ALL (SELECT a FROM u)")).To(BeTrue())
+			Expect(sqlspanner.IsSelect("WITH x AS (SELECT 1 AS a) SELECT a FROM x")).To(BeTrue())
+			Expect(sqlspanner.IsSelect("@{USE_ADDITIONAL_PARALLELISM=TRUE} SELECT a FROM t")).To(BeTrue())
+			Expect(sqlspanner.IsSelect("-- find the users\n/* all of them */ SELECT * FROM users")).To(BeTrue())
+		})
+
+		It("does not recognize other statements", func() {
+			Expect(sqlspanner.IsSelect("UPDATE t SET a = 1 WHERE TRUE")).To(BeFalse())
+			Expect(sqlspanner.IsSelect("INSERT INTO t (a) SELECT a FROM u")).To(BeFalse())
+			Expect(sqlspanner.IsSelect("SELECTED")).To(BeFalse())
+			Expect(sqlspanner.IsSelect("-- SELECT\nDELETE FROM t WHERE TRUE")).To(BeFalse())
+		})
+
+		It("recognizes every statement that returns rows", func() {
+			Expect(sqlspanner.IsQuery("SELECT 1")).To(BeTrue())
+			Expect(sqlspanner.IsQuery("EXPLAIN ANALYZE SELECT a FROM t")).To(BeTrue())
+			Expect(sqlspanner.IsQuery("RUN PARTITION 'abc'")).To(BeTrue())
+			Expect(sqlspanner.IsQuery("CREATE TABLE t (a INT64) PRIMARY KEY (a)")).To(BeFalse())
+			Expect(sqlspanner.IsQuery("START BATCH DML")).To(BeFalse())
+		})
+	})
+
+	Describe("rewriting params", func() {
+		It("leaves ? in strings, identifiers, and comments alone", func() {
+			query, args := sqlspanner.ToNamedParams("SELECT '?', \"a?\", `b?`, '''c\n?''' /* ? */ FROM t WHERE a = ? -- ?\nAND b = ?")
+			Expect(query).To(Equal("SELECT '?', \"a?\", `b?`, '''c\n?''' /* ? */ FROM t WHERE a = @p0 -- ?\nAND b = @p1"))
+			filled, err := args.GetFilledArgs([]driver.Value{int64(1), int64(2)})
+			Expect(err).To(BeNil())
+			Expect(filled).To(Equal(map[string]interface{}{"p0": int64(1), "p1": int64(2)}))
+		})
+
+		It("handles escaped quotes", func() {
+			query, _ := sqlspanner.ToNamedParams(`SELECT 'it\'s?' FROM t WHERE a = ?`)
+			Expect(query).To(Equal(`SELECT 'it\'s?' FROM t WHERE a = @p0`))
+		})
+	})
+
+	Describe("splitting scripts", func() {
+		It("splits on semicolons outside of strings and comments", func() {
+			stmts, rest := sqlspanner.SplitStatements("SELECT 'a;b' FROM t; -- c;d\nSELECT `x;` FROM t /* ; */; SELECT 1")
+			Expect(stmts).To(Equal([]string{"SELECT 'a;b' FROM t", "-- c;d\nSELECT `x;` FROM t /* ; */"}))
+			Expect(rest).To(Equal(" SELECT 1"))
+		})
+
+		It("leaves a statement with an unterminated string in the rest", func() {
+			stmts, rest := sqlspanner.SplitStatements("SELECT 1; SELECT 'a;\n")
+			Expect(stmts).To(Equal([]string{"SELECT 1"}))
+			Expect(rest).To(Equal(" SELECT 'a;\n"))
+			stmts, rest = sqlspanner.SplitStatements(rest + "b';\n")
+			Expect(stmts).To(Equal([]string{"SELECT 'a;\nb'"}))
+			Expect(rest).To(Equal("\n"))
+		})
+
+		It("skips empty statements and comments", func() {
+			stmts, _ := sqlspanner.SplitStatements(";; -- nothing;\n/* here */;")
+			Expect(stmts).To(BeEmpty())
+		})
+	})
+
+	Describe("preparing selects the mysql parser does not understand", func() {
+		It("sends them to spanner as they are", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			query, err := sqlspanner.PrepareRawSelect(c, "SELECT ARRAY<STRING>['a', ?] AS xs, SAFE.PARSE_DATE('%Y', ?) FROM UNNEST([1, 2]) AS n WHERE n > ?")
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("SELECT ARRAY<STRING>['a', @p0] AS xs, SAFE.PARSE_DATE('%Y', @p1) FROM UNNEST([1, 2]) AS n WHERE n > @p2"))
+		})
+
+		It("keeps hints, and WITH clauses", func() {
+			c := sqlspanner.NewUnconnectedConn()
+			query, err := sqlspanner.PrepareRawSelect(c, "@{USE_ADDITIONAL_PARALLELISM=TRUE} WITH x AS (SELECT STRUCT(1 AS a) AS s) SELECT s.a FROM x TABLESAMPLE BERNOULLI (10 PERCENT)")
+			Expect(err).To(BeNil())
+			Expect(query).To(Equal("@{USE_ADDITIONAL_PARALLELISM=TRUE} WITH x AS (SELECT STRUCT(1 AS a) AS s) SELECT s.a FROM x TABLESAMPLE BERNOULLI (10 PERCENT)"))
+		})
+	})
+})
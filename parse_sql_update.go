@@ -61,7 +61,7 @@ func extractUpdateClause(update *sqlparser.Update) (*partialArgMap, error) {
 			return nil, fmt.Errorf("No column name associated with expression %+v", updateExpr.Expr)
 		}
 		if len(updateExpr.Name.Qualifier) > 0 {
-			return nil, fmt.Errorf("qualifiers on column names not allowed for update clause")
+			return nil, &UnsupportedSQLError{Construct: "column name qualifiers", Statement: "UPDATE"}
 		}
 		if len(updateExpr.Name.Name) <= 0 {
 			return nil, fmt.Errorf("No column name associated with expression %+v", updateExpr.Expr)
@@ -73,6 +73,9 @@ func extractUpdateClause(update *sqlparser.Update) (*partialArgMap, error) {
 		}
 		updatedVals.AddArg(name, arg)
 	}
+	if update.Where == nil {
+		return nil, fmt.Errorf("Must include a where clause that contain primary keys in update statement")
+	}
 	upMap := updateMap{updatedVals: updatedVals, myArgs: myArgs}
 	err := upMap.walkBoolExpr(update.Where.Expr)
 	if err != nil {
@@ -98,7 +101,7 @@ func (u *updateMap) walkBoolExpr(boolExpr sqlparser.BoolExpr) error {
 			return err
 		}
 		if expr.Operator != "=" {
-			return fmt.Errorf("only =  operator is supported in update query's Where clause")
+			return &UnsupportedSQLError{Construct: fmt.Sprintf("%s operator in the WHERE clause", expr.Operator), Statement: "UPDATE"}
 		}
 		val, err := u.myArgs.ParseValExpr(expr.Right)
 		if err != nil {
@@ -112,11 +115,11 @@ func (u *updateMap) walkBoolExpr(boolExpr sqlparser.BoolExpr) error {
 			return err
 		}
 		if expr.Operator != "is null" {
-			return fmt.Errorf(`only "is null" checks are supported in update query's Where clause`)
+			return &UnsupportedSQLError{Construct: fmt.Sprintf("%s check in the WHERE clause", expr.Operator), Statement: "UPDATE"}
 		}
 		u.updatedVals.AddArg(name, nil)
 	default:
-		return fmt.Errorf("Unsupported Boolexpr, only support AndExpr, NullCheck, or ComparisonExpr with =")
+		return &UnsupportedSQLError{Construct: fmt.Sprintf("%s in the WHERE clause", nodeName(boolExpr)), Statement: "UPDATE"}
 	}
 	return nil
 }
@@ -128,7 +131,7 @@ func (u *updateMap) validColNameFromValExpr(expr sqlparser.ValExpr) (string, err
 	}
 
 	if len(col.Qualifier) > 0 {
-		return "", fmt.Errorf("qualifiers not supported in update queries")
+		return "", &UnsupportedSQLError{Construct: "column name qualifiers", Statement: "UPDATE"}
 	}
 	name := string(col.Name[:])
 	if _, present := u.updatedVals.args[name]; present {
@@ -0,0 +1,188 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/gob"
+	"fmt"
+	"regexp"
+
+	"cloud.google.com/go/spanner"
+)
+
+// RUN PARTITION runs one partition of a PartitionedQuery, from any connection to the database:
+//   rows, err := db.QueryContext(ctx, "RUN PARTITION ?", partition)
+var runPartitionRegexp = regexp.MustCompile(`(?is)^\s*RUN\s+PARTITION\s+(?:\?|'([^']*)')\s*;?\s*$`)
+
+// returns whether the query is a RUN PARTITION statement, and the partition if it
+// is given in the query instead of as an arg
+func parseRunPartition(query string) (bool, string) {
+	matches := runPartitionRegexp.FindStringSubmatch(query)
+	if matches == nil {
+		return false, ""
+	}
+	return true, matches[1]
+}
+
+// PartitionedQuery is a SELECT split into partitions that can be read in parallel,
+// by different connections or processes. Every partition reads from the same
+// snapshot of the database
+type PartitionedQuery struct {
+	// a string for each partition, run it with RUN PARTITION
+	Partitions []string
+
+	txn *spanner.BatchReadOnlyTransaction
+}
+
+// Close frees the resources spanner holds for the query's snapshot, once every
+// partition has been read
+func (q *PartitionedQuery) Close(ctx context.Context) {
+	q.txn.Cleanup(ctx)
+}
+
+// PartitionQuery splits a SELECT into partitions that are read at a strong snapshot
+// of the database. The query has to be root partitionable: its first operator has to
+// be a distributed union, queries with ORDER BY, or aggregations over the whole table
+// are not. Args are given for each ? in the query
+//   q, err := connector.PartitionQuery(ctx, "SELECT * FROM events WHERE day = ?", day)
+//   for _, p := range q.Partitions {
+//   	go export(db, p) // db.QueryContext(ctx, "RUN PARTITION ?", p)
+//   }
+func (c *Connector) PartitionQuery(ctx context.Context, query string, args ...interface{}) (*PartitionedQuery, error) {
+	client, err := c.spannerClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	namedQuery, pArgMap := toNamedParams(query)
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if !IsValue(arg) {
+			return nil, &ConversionError{Column: fmt.Sprintf("arg %d", i+1), Type: fmt.Sprintf("%T", arg), Err: fmt.Errorf("value will not fit in spanner %#v", arg)}
+		}
+		values[i], err = toJSONValue(arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	params, err := pArgMap.GetFilledArgs(values)
+	if err != nil {
+		return nil, err
+	}
+	txn, err := client.BatchReadOnlyTransaction(ctx, spanner.StrongRead())
+	if err != nil {
+		return nil, spannerError(err)
+	}
+	partitions, err := txn.PartitionQuery(ctx, spanner.Statement{SQL: namedQuery, Params: params}, spanner.PartitionOptions{})
+	if err != nil {
+		txn.Cleanup(ctx)
+		return nil, spannerError(err)
+	}
+	q := &PartitionedQuery{txn: txn}
+	for _, p := range partitions {
+		encoded, err := encodePartition(txn.ID, p)
+		if err != nil {
+			txn.Cleanup(ctx)
+			return nil, err
+		}
+		q.Partitions = append(q.Partitions, encoded)
+	}
+	return q, nil
+}
+
+// a partition with the id of its transaction, everything needed to read it
+type partitionDescriptor struct {
+	Transaction []byte
+	Partition   []byte
+}
+
+func encodePartition(tid spanner.BatchReadOnlyTransactionID, p *spanner.Partition) (string, error) {
+	var desc partitionDescriptor
+	var err error
+	if desc.Transaction, err = tid.MarshalBinary(); err != nil {
+		return "", err
+	}
+	if desc.Partition, err = p.MarshalBinary(); err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(desc); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+func decodePartition(encoded string) (spanner.BatchReadOnlyTransactionID, *spanner.Partition, error) {
+	var tid spanner.BatchReadOnlyTransactionID
+	bs, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return tid, nil, fmt.Errorf("invalid partition: %v", err)
+	}
+	var desc partitionDescriptor
+	if err := gob.NewDecoder(bytes.NewReader(bs)).Decode(&desc); err != nil {
+		return tid, nil, fmt.Errorf("invalid partition: %v", err)
+	}
+	if err := tid.UnmarshalBinary(desc.Transaction); err != nil {
+		return tid, nil, fmt.Errorf("invalid partition: %v", err)
+	}
+	p := &spanner.Partition{}
+	if err := p.UnmarshalBinary(desc.Partition); err != nil {
+		return tid, nil, fmt.Errorf("invalid partition: %v", err)
+	}
+	return tid, p, nil
+}
+
+// reads a partition, given in the RUN PARTITION statement or as its only arg
+func (s *stmt) runPartition(ctx context.Context, args []driver.Value) (*rows, error) {
+	encoded := s.partition
+	if encoded == "" {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("RUN PARTITION expects the partition as its only arg, got %d args", len(args))
+		}
+		switch arg := args[0].(type) {
+		case string:
+			encoded = arg
+		case []byte:
+			encoded = string(arg)
+		default:
+			return nil, fmt.Errorf("RUN PARTITION expects the partition as a string, got %T", args[0])
+		}
+	}
+	tid, p, err := decodePartition(encoded)
+	if err != nil {
+		return nil, err
+	}
+	txn := s.conn.client.BatchReadOnlyTransactionFromID(tid)
+	return newRowsFromSpannerIterator(txn.Execute(ctx, p)), nil
+}
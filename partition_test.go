@@ -0,0 +1,106 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"cloud.google.com/go/spanner"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/proto"
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// a query partition like spanner would return, partitions can only be made by unmarshaling
+func testPartition(token string, sql string) *spanner.Partition {
+	req, err := proto.Marshal(&v1.ExecuteSqlRequest{Sql: sql, PartitionToken: []byte(token)})
+	Expect(err).To(BeNil())
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	Expect(enc.Encode([]byte(token))).To(Succeed())
+	Expect(enc.Encode(false)).To(Succeed())
+	Expect(enc.Encode(req)).To(Succeed())
+	p := &spanner.Partition{}
+	Expect(p.UnmarshalBinary(buf.Bytes())).To(Succeed())
+	return p
+}
+
+var _ = Describe("Partitioned queries", func() {
+	Describe("RUN PARTITION", func() {
+		It("takes the partition as an arg", func() {
+			ok, partition := sqlspanner.ParseRunPartition("RUN PARTITION ?")
+			Expect(ok).To(BeTrue())
+			Expect(partition).To(Equal(""))
+		})
+
+		It("takes the partition in the statement", func() {
+			ok, partition := sqlspanner.ParseRunPartition("run partition 'abc-123_';")
+			Expect(ok).To(BeTrue())
+			Expect(partition).To(Equal("abc-123_"))
+		})
+
+		It("ignores other statements", func() {
+			ok, _ := sqlspanner.ParseRunPartition("RUN BATCH")
+			Expect(ok).To(BeFalse())
+		})
+	})
+
+	Describe("partition descriptors", func() {
+		It("survive a round trip through a string", func() {
+			encoded, err := sqlspanner.EncodePartition(spanner.BatchReadOnlyTransactionID{}, testPartition("token", "SELECT a FROM t"))
+			Expect(err).To(BeNil())
+			Expect(encoded).ToNot(BeEmpty())
+			_, p, err := sqlspanner.DecodePartition(encoded)
+			Expect(err).To(BeNil())
+			Expect(p.GetPartitionToken()).To(Equal([]byte("token")))
+		})
+
+		It("rejects strings that are not partitions", func() {
+			_, _, err := sqlspanner.DecodePartition("not a partition")
+			Expect(err).ToNot(BeNil())
+			_, _, err = sqlspanner.DecodePartition("bm90IGEgcGFydGl0aW9u")
+			Expect(err).ToNot(BeNil())
+		})
+	})
+
+	It("provides a connector", func() {
+		connector, err := sqlspanner.NewConnector("projects/p/instances/i/databases/d")
+		Expect(err).To(BeNil())
+		Expect(connector.Driver()).ToNot(BeNil())
+		Expect(connector.Close()).To(BeNil())
+		_, err = sqlspanner.NewConnector("projects/p/instances/i/databases/d?nope=1")
+		Expect(err).ToNot(BeNil())
+	})
+})
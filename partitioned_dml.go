@@ -0,0 +1,102 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+
+	"cloud.google.com/go/spanner"
+	"github.com/xwb1989/sqlparser"
+)
+
+var setDMLModeRegexp = regexp.MustCompile(`(?is)^\s*SET\s+AUTOCOMMIT_DML_MODE\s*=\s*'([^']*)'\s*;?\s*$`)
+
+// parses a SET AUTOCOMMIT_DML_MODE = '<mode>' statement. Like batch commands,
+// it is handled by the driver and never sent to spanner
+func parseSetDMLMode(query string) (*AutocommitDMLMode, bool, error) {
+	matches := setDMLModeRegexp.FindStringSubmatch(query)
+	if matches == nil {
+		return nil, false, nil
+	}
+	mode, err := parseAutocommitDMLMode(matches[1])
+	if err != nil {
+		return nil, true, err
+	}
+	return &mode, true, nil
+}
+
+func (c *conn) AutocommitDMLMode() AutocommitDMLMode {
+	return c.dmlMode
+}
+
+func (c *conn) SetAutocommitDMLMode(mode AutocommitDMLMode) error {
+	switch mode {
+	case AutocommitDMLModeTransactional, AutocommitDMLModePartitionedNonAtomic:
+		c.dmlMode = mode
+		return nil
+	}
+	return fmt.Errorf("unknown autocommit dml mode %v", mode)
+}
+
+// runs an UPDATE or DELETE with PartitionedUpdate. Spanner runs the statement
+// on each partition of the table separately, so the count it returns is a
+// lower bound of the rows that were changed
+func (s *stmt) executePartitionedDML(ctx context.Context, args []driver.Value) (driver.Result, error) {
+	if !s.conn.cfg.AllowUnboundedWrites {
+		switch st := s.parsedStatement.(type) {
+		case *sqlparser.Update:
+			if st.Where == nil {
+				return nil, &UnboundedWriteError{Statement: "UPDATE", Table: s.tableName}
+			}
+		case *sqlparser.Delete:
+			if st.Where == nil {
+				return nil, &UnboundedWriteError{Statement: "DELETE", Table: s.tableName}
+			}
+		}
+	}
+	params, err := s.dmlArgs().GetFilledArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	stmt := spanner.Statement{SQL: s.dmlQuery, Params: params}
+	if s.conn.planWrites(&PlannedWrite{Op: "PARTITIONED DML", Table: s.tableName, Statement: &stmt}) {
+		rowsAffected := int64(0)
+		return &result{rowsAffected: &rowsAffected}, nil
+	}
+	rowsAffected, err := s.conn.client.PartitionedUpdate(ctx, stmt)
+	if err != nil {
+		return nil, spannerError(err)
+	}
+	return &result{rowsAffected: &rowsAffected}, nil
+}
@@ -0,0 +1,68 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"github.com/tcncloud/sqlspanner"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Partitioned DML", func() {
+	Describe("SET AUTOCOMMIT_DML_MODE", func() {
+		It("parses the partitioned mode", func() {
+			mode, ok, err := sqlspanner.ParseSetDMLMode("SET AUTOCOMMIT_DML_MODE = 'PARTITIONED_NON_ATOMIC'")
+			Expect(ok).To(BeTrue())
+			Expect(err).To(BeNil())
+			Expect(mode).To(Equal(sqlspanner.AutocommitDMLModePartitionedNonAtomic))
+		})
+
+		It("parses the transactional mode, ignoring case", func() {
+			mode, ok, err := sqlspanner.ParseSetDMLMode("set autocommit_dml_mode='transactional';")
+			Expect(ok).To(BeTrue())
+			Expect(err).To(BeNil())
+			Expect(mode).To(Equal(sqlspanner.AutocommitDMLModeTransactional))
+		})
+
+		It("rejects unknown modes", func() {
+			_, ok, err := sqlspanner.ParseSetDMLMode("SET AUTOCOMMIT_DML_MODE = 'SOMETIMES'")
+			Expect(ok).To(BeTrue())
+			Expect(err).ToNot(BeNil())
+		})
+
+		It("ignores other statements", func() {
+			_, ok, err := sqlspanner.ParseSetDMLMode("UPDATE t SET a = 1 WHERE b < 2")
+			Expect(ok).To(BeFalse())
+			Expect(err).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,258 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+
+	"cloud.google.com/go/spanner"
+	"github.com/xwb1989/sqlparser"
+)
+
+// a SELECT of plain columns from one table, filtered only by = and IN comparisons
+// ANDed together, like:
+//   SELECT id, name FROM users WHERE id = ?
+//   SELECT id, name FROM users WHERE org = ? AND id IN (?, ?, ?)
+// When the filtered columns are the table's whole primary key the select is run
+// with the Read api instead of the query engine, which is cheaper for point lookups.
+// With a FORCE_INDEX hint the filtered columns have to be the index's key columns,
+// and the selected columns have to be stored in the index
+type pointLookup struct {
+	table   string
+	index   string
+	columns []string
+	keys    *AwareKeySet
+}
+
+// returns nil when the select is not a point lookup, it is then run as a query
+func extractPointLookup(sel *sqlparser.Select, hints *queryHints) *pointLookup {
+	if !hints.onlyForceIndex() {
+		return nil
+	}
+	if sel.Distinct != "" || len(sel.GroupBy) != 0 || sel.Having != nil || len(sel.OrderBy) != 0 ||
+		sel.Limit != nil || sel.Lock != "" || sel.Where == nil || len(sel.From) != 1 {
+		return nil
+	}
+	aliased, ok := sel.From[0].(*sqlparser.AliasedTableExpr)
+	if !ok || aliased.Hints != nil {
+		return nil
+	}
+	tableName, ok := aliased.Expr.(*sqlparser.TableName)
+	if !ok || len(tableName.Qualifier) != 0 {
+		return nil
+	}
+	columns := make([]string, 0, len(sel.SelectExprs))
+	for _, selectExpr := range sel.SelectExprs {
+		// SELECT * needs the table's columns, and aliases would rename them
+		nonStar, ok := selectExpr.(*sqlparser.NonStarExpr)
+		if !ok || len(nonStar.As) != 0 {
+			return nil
+		}
+		col, ok := nonStar.Expr.(*sqlparser.ColName)
+		if !ok || len(col.Qualifier) != 0 {
+			return nil
+		}
+		columns = append(columns, string(col.Name[:]))
+	}
+	keys := &AwareKeySet{
+		Args:     &Args{},
+		Keys:     make(map[string]*Key),
+		KeyOrder: make([]string, 0),
+	}
+	if err := keys.walkBoolExpr(sel.Where.Expr); err != nil {
+		return nil
+	}
+	for _, key := range keys.Keys {
+		// the key's values only hold its last comparison, like the 2 of id = 1 AND id = 2
+		if key.Conditions > 1 || !isPointKey(key) {
+			return nil
+		}
+	}
+	table := string(tableName.Name[:])
+	return &pointLookup{table: table, index: hints.forcedIndex(table), columns: columns, keys: keys}
+}
+
+// the key was compared with =, or an IN list
+func isPointKey(key *Key) bool {
+	if key.InValues != nil {
+		return true
+	}
+	return key.HaveLower && key.HaveUpper && !key.LowerOpen && !key.UpperOpen && key.LowerValue == key.UpperValue
+}
+
+// reads the rows with the Read api. ok is false when the filtered columns are
+// not the table's primary key, or a key has a NULL, the select has to be queried then
+func (p *pointLookup) read(ctx context.Context, c *conn, args []driver.Value) (iter *spanner.RowIterator, ok bool, err error) {
+	indexName := p.index
+	if indexName == "" {
+		indexName = primaryKeyIndex
+	}
+	if c.noInformationSchema {
+		return nil, false, nil
+	}
+	index, err := c.indexColumns(ctx, p.table, indexName)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(index.keys) != len(p.keys.Keys) {
+		return nil, false, nil
+	}
+	if p.index != "" {
+		// ReadUsingIndex can only return the index's columns, and the primary key
+		primaryKey, err := c.indexColumns(ctx, p.table, primaryKeyIndex)
+		if err != nil {
+			return nil, false, err
+		}
+		for _, col := range p.columns {
+			if !index.has(col) && !primaryKey.has(col) {
+				return nil, false, nil
+			}
+		}
+	}
+	// the values for each key column, in key order
+	values := make([][]interface{}, len(index.keys))
+	for i, keyCol := range index.keys {
+		var key *Key
+		for name, k := range p.keys.Keys {
+			if strings.EqualFold(name, keyCol) {
+				key = k
+			}
+		}
+		if key == nil {
+			return nil, false, nil
+		}
+		vals := key.InValues
+		if vals == nil {
+			vals = []interface{}{key.LowerValue}
+		}
+		filled := make([]interface{}, len(vals))
+		for j, v := range vals {
+			if ap, isArg := v.(ArgPlaceholder); isArg {
+				if ap.queuePos >= len(args) {
+					return nil, false, fmt.Errorf("expected at least %d args", ap.queuePos+1)
+				}
+				v = args[ap.queuePos]
+			}
+			// = NULL matches nothing in a query, but would read the NULL key
+			if v == nil {
+				return nil, false, nil
+			}
+			filled[j] = v
+		}
+		values[i] = filled
+	}
+	keys := []spanner.Key{{}}
+	for _, vals := range values {
+		next := make([]spanner.Key, 0, len(keys)*len(vals))
+		for _, key := range keys {
+			for _, v := range vals {
+				next = append(next, append(append(spanner.Key{}, key...), v))
+			}
+		}
+		keys = next
+	}
+	if len(keys) == 0 {
+		// an empty IN list
+		return nil, false, nil
+	}
+	if p.index != "" {
+		// index keys are not unique, every entry of the index starting with the key is read
+		ranges := make([]spanner.KeySet, len(keys))
+		for i, key := range keys {
+			ranges[i] = spanner.KeyRange{Start: key, End: key, Kind: spanner.ClosedClosed}
+		}
+		iter = c.client.Single().ReadUsingIndex(ctx, p.table, p.index, spanner.KeySets(ranges...), p.columns)
+		return iter, true, nil
+	}
+	// Read is used for single keys too, unlike ReadRow it reports the
+	// columns when the row does not exist
+	iter = c.client.Single().Read(ctx, p.table, spanner.KeySetFromKeys(keys...), p.columns)
+	return iter, true, nil
+}
+
+// the name of a table's primary key in the information schema
+const primaryKeyIndex = "PRIMARY_KEY"
+
+type indexColumns struct {
+	// the key columns in order
+	keys []string
+	// the columns stored in the index without being part of its key
+	stored []string
+}
+
+func (i *indexColumns) has(col string) bool {
+	for _, c := range append(i.keys, i.stored...) {
+		if strings.EqualFold(c, col) {
+			return true
+		}
+	}
+	return false
+}
+
+// the columns of an index, or of the primary key, read from the information
+// schema once per connection, and again after the connection changes the schema
+func (c *conn) indexColumns(ctx context.Context, table, index string) (*indexColumns, error) {
+	cacheKey := table + "@" + index
+	if cols, ok := c.indexes[cacheKey]; ok {
+		return cols, nil
+	}
+	stmt := spanner.Statement{
+		SQL: `SELECT COLUMN_NAME, ORDINAL_POSITION IS NOT NULL FROM INFORMATION_SCHEMA.INDEX_COLUMNS
+		      WHERE TABLE_SCHEMA = '' AND TABLE_NAME = @table AND INDEX_NAME = @index
+		      ORDER BY ORDINAL_POSITION`,
+		Params: map[string]interface{}{"table": table, "index": index},
+	}
+	cols := &indexColumns{}
+	err := c.client.Single().Query(ctx, stmt).Do(func(row *spanner.Row) error {
+		var col string
+		var isKey bool
+		if err := row.Columns(&col, &isKey); err != nil {
+			return err
+		}
+		if isKey {
+			cols.keys = append(cols.keys, col)
+		} else {
+			cols.stored = append(cols.stored, col)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, spannerError(err)
+	}
+	if c.indexes == nil {
+		c.indexes = make(map[string]*indexColumns)
+	}
+	c.indexes[cacheKey] = cols
+	return cols, nil
+}
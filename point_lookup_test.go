@@ -0,0 +1,169 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner_test
+
+import (
+	"github.com/tcncloud/sqlspanner"
+	"github.com/xwb1989/sqlparser"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func col(name string) *sqlparser.ColName {
+	return &sqlparser.ColName{Name: []byte(name)}
+}
+
+// SELECT <cols> FROM users WHERE <where>
+func selectFromUsers(where sqlparser.BoolExpr, cols ...string) *sqlparser.Select {
+	exprs := sqlparser.SelectExprs{}
+	for _, c := range cols {
+		exprs = append(exprs, &sqlparser.NonStarExpr{Expr: col(c)})
+	}
+	sel := &sqlparser.Select{
+		SelectExprs: exprs,
+		From:        sqlparser.TableExprs{&sqlparser.AliasedTableExpr{Expr: &sqlparser.TableName{Name: []byte("users")}}},
+	}
+	if where != nil {
+		sel.Where = &sqlparser.Where{Type: "where", Expr: where}
+	}
+	return sel
+}
+
+var _ = Describe("Point lookups", func() {
+	It("recognizes equality comparisons", func() {
+		where := &sqlparser.AndExpr{
+			Left:  &sqlparser.ComparisonExpr{Operator: "=", Left: col("org"), Right: sqlparser.StrVal("tcn")},
+			Right: &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.ValArg("?")},
+		}
+		lookup := sqlspanner.ExtractPointLookup(selectFromUsers(where, "id", "name"), nil)
+		Expect(lookup).ToNot(BeNil())
+		Expect(lookup.Table()).To(Equal("users"))
+		Expect(lookup.Columns()).To(Equal([]string{"id", "name"}))
+		vals := lookup.KeyValues()
+		Expect(vals).To(HaveLen(2))
+		Expect(vals["org"]).To(Equal([]interface{}{"tcn"}))
+		Expect(vals["id"]).To(HaveLen(1))
+	})
+
+	It("recognizes IN lists", func() {
+		where := &sqlparser.ComparisonExpr{
+			Operator: "in",
+			Left:     col("id"),
+			Right:    sqlparser.ValTuple{sqlparser.NumVal("1"), sqlparser.NumVal("2"), sqlparser.NumVal("3")},
+		}
+		lookup := sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), nil)
+		Expect(lookup).ToNot(BeNil())
+		Expect(lookup.KeyValues()["id"]).To(Equal([]interface{}{int64(1), int64(2), int64(3)}))
+	})
+
+	It("does not treat ranges as lookups", func() {
+		where := &sqlparser.ComparisonExpr{Operator: ">", Left: col("id"), Right: sqlparser.NumVal("1")}
+		Expect(sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), nil)).To(BeNil())
+	})
+
+	It("does not treat ORs as lookups", func() {
+		where := &sqlparser.OrExpr{
+			Left:  &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("1")},
+			Right: &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("2")},
+		}
+		Expect(sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), nil)).To(BeNil())
+	})
+
+	It("does not read keys compared more than once", func() {
+		where := &sqlparser.AndExpr{
+			Left: &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("1")},
+			Right: &sqlparser.ComparisonExpr{
+				Operator: "in",
+				Left:     col("id"),
+				Right:    sqlparser.ValTuple{sqlparser.NumVal("2"), sqlparser.NumVal("3")},
+			},
+		}
+		Expect(sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), nil)).To(BeNil())
+		where = &sqlparser.AndExpr{
+			Left:  &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("1")},
+			Right: &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("2")},
+		}
+		Expect(sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), nil)).To(BeNil())
+	})
+
+	It("needs a where clause", func() {
+		Expect(sqlspanner.ExtractPointLookup(selectFromUsers(nil, "id"), nil)).To(BeNil())
+	})
+
+	It("needs plain columns", func() {
+		where := &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("1")}
+		sel := selectFromUsers(where)
+		sel.SelectExprs = sqlparser.SelectExprs{&sqlparser.StarExpr{}}
+		Expect(sqlspanner.ExtractPointLookup(sel, nil)).To(BeNil())
+		sel.SelectExprs = sqlparser.SelectExprs{&sqlparser.NonStarExpr{Expr: col("id"), As: []byte("user_id")}}
+		Expect(sqlspanner.ExtractPointLookup(sel, nil)).To(BeNil())
+	})
+
+	It("does not read ordered, or limited selects", func() {
+		where := &sqlparser.ComparisonExpr{Operator: "=", Left: col("id"), Right: sqlparser.NumVal("1")}
+		sel := selectFromUsers(where, "id")
+		sel.OrderBy = sqlparser.OrderBy{&sqlparser.Order{Expr: col("id"), Direction: "asc"}}
+		Expect(sqlspanner.ExtractPointLookup(sel, nil)).To(BeNil())
+		sel = selectFromUsers(where, "id")
+		sel.Limit = &sqlparser.Limit{Rowcount: sqlparser.NumVal("1")}
+		Expect(sqlspanner.ExtractPointLookup(sel, nil)).To(BeNil())
+	})
+
+	Describe("with hints", func() {
+		var where sqlparser.BoolExpr
+		BeforeEach(func() {
+			where = &sqlparser.ComparisonExpr{Operator: "=", Left: col("email"), Right: sqlparser.ValArg("?")}
+		})
+
+		It("reads the forced index", func() {
+			_, hints, err := sqlspanner.StripHints("SELECT id FROM users@{FORCE_INDEX=users_by_email} WHERE email = ?")
+			Expect(err).To(BeNil())
+			lookup := sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), hints)
+			Expect(lookup).ToNot(BeNil())
+			Expect(lookup.Index()).To(Equal("users_by_email"))
+		})
+
+		It("reads the base table when it is forced", func() {
+			_, hints, err := sqlspanner.StripHints("SELECT id FROM users@{FORCE_INDEX=_BASE_TABLE} WHERE email = ?")
+			Expect(err).To(BeNil())
+			lookup := sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), hints)
+			Expect(lookup).ToNot(BeNil())
+			Expect(lookup.Index()).To(Equal(""))
+		})
+
+		It("leaves other hints to the query engine", func() {
+			_, hints, err := sqlspanner.StripHints("@{USE_ADDITIONAL_PARALLELISM=TRUE} SELECT id FROM users WHERE email = ?")
+			Expect(err).To(BeNil())
+			Expect(sqlspanner.ExtractPointLookup(selectFromUsers(where, "id"), hints)).To(BeNil())
+		})
+	})
+})
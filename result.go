@@ -30,11 +30,16 @@
 
 package sqlspanner
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type result struct {
-	lastID       *int64
-	rowsAffected *int64
+	lastID          *int64
+	rowsAffected    *int64
+	commitTimestamp *time.Time
+	planned         []*PlannedWrite
 }
 
 func (r *result) LastInsertId() (int64, error) {
@@ -50,3 +55,16 @@ func (r *result) RowsAffected() (int64, error) {
 	}
 	return 0, fmt.Errorf("no rows affected set")
 }
+
+// the time spanner committed the exec's changes, only set for execs that commit
+func (r *result) CommitTimestamp() (time.Time, error) {
+	if r.commitTimestamp != nil {
+		return *r.commitTimestamp, nil
+	}
+	return time.Time{}, fmt.Errorf("no commit timestamp set")
+}
+
+// the writes the exec built in dry run mode, instead of sending them to spanner
+func (r *result) PlannedWrites() []*PlannedWrite {
+	return r.planned
+}
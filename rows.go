@@ -33,9 +33,11 @@ package sqlspanner
 import (
 	"database/sql/driver"
 	"io"
+	"reflect"
 
 	"cloud.google.com/go/spanner"
 	"google.golang.org/api/iterator"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
 )
 
 type rows struct {
@@ -43,11 +45,15 @@ type rows struct {
 	row    *spanner.Row
 	valuer valueConverter
 	cols   []string
+	types  []*v1.Type
 	err    error
 }
 
 func newRowsFromSpannerIterator(iter *spanner.RowIterator) *rows {
-	return newRowsFromNextable(iter)
+	if iter == nil {
+		return newRowsFromNextable(nil)
+	}
+	return newRowsFromNextable(spannerRowIterator{iter})
 }
 
 func newRowsFromNextable(iter nextable) *rows {
@@ -63,8 +69,18 @@ func newRowsFromNextable(iter nextable) *rows {
 	}
 
 	r.iterate()
-	if r.err == nil {
+	// prefer the result set metadata, it is available even when there are no rows
+	if mn, ok := r.iter.(metadataNextable); ok && mn.Metadata() != nil {
+		fields := mn.Metadata().GetRowType().GetFields()
+		r.cols = make([]string, len(fields))
+		r.types = make([]*v1.Type, len(fields))
+		for i, f := range fields {
+			r.cols[i] = f.Name
+			r.types[i] = f.Type
+		}
+	} else if r.err == nil {
 		r.cols = r.row.ColumnNames()
+		r.types = columnTypes(r.row)
 	}
 	return r
 }
@@ -78,9 +94,18 @@ func newRowsFromSpannerRow(row *spanner.Row) *rows {
 		valuer: valueConverter{},
 		row:    row,
 		cols:   row.ColumnNames(),
+		types:  columnTypes(row),
 	}
 }
 
+func columnTypes(row *spanner.Row) []*v1.Type {
+	types := make([]*v1.Type, row.Size())
+	for i := range types {
+		types[i] = row.ColumnType(i)
+	}
+	return types
+}
+
 func (r *rows) iterate() {
 	if r.iter == nil {
 		r.err = io.EOF
@@ -91,7 +116,7 @@ func (r *rows) iterate() {
 		if err == iterator.Done {
 			r.err = io.EOF
 		} else if err != nil {
-			r.err = err
+			r.err = spannerError(err)
 		} else {
 			r.row = row
 		}
@@ -118,7 +143,7 @@ func (r *rows) handleRow(dest []driver.Value) {
 		driverVal, err := r.valuer.ConvertGenericCol(col)
 		if err != nil {
 			// abort everything ever for this iterator
-			r.err = err
+			r.err = &ConversionError{Column: row.ColumnName(i), Type: databaseTypeName(col.Type), Err: err}
 			return
 		}
 		//dest is the same size as columns, so we dont need to append
@@ -148,6 +173,41 @@ func (r *rows) Columns() []string {
 	return r.cols
 }
 
+func (r *rows) columnType(index int) *v1.Type {
+	if index < 0 || index >= len(r.types) {
+		return nil
+	}
+	return r.types[index]
+}
+
+// implements driver.RowsColumnTypeDatabaseTypeName
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	return databaseTypeName(r.columnType(index))
+}
+
+// implements driver.RowsColumnTypeScanType
+func (r *rows) ColumnTypeScanType(index int) reflect.Type {
+	return scanType(r.columnType(index), r.valuer.mode)
+}
+
+// implements driver.RowsColumnTypeNullable. Spanner's result set
+// metadata does not include whether a column is nullable
+func (r *rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return false, false
+}
+
+// implements driver.RowsColumnTypeLength
+func (r *rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	return columnLength(r.columnType(index))
+}
+
+func (r *rows) queryStats() map[string]interface{} {
+	if sn, ok := r.iter.(statsNextable); ok {
+		return sn.QueryStats()
+	}
+	return nil
+}
+
 func (r *rows) Close() error {
 	if r.iter != nil {
 		r.iter.Stop()
@@ -171,3 +231,29 @@ type nextable interface {
 	Next() (*spanner.Row, error)
 	Stop()
 }
+
+// a nextable that can also describe the rows it returns. Used to get the columns
+// of a result set that has no rows
+type metadataNextable interface {
+	nextable
+	Metadata() *v1.ResultSetMetadata
+}
+
+// spanner.RowIterator only sets its Metadata field after the first call to Next
+type spannerRowIterator struct {
+	*spanner.RowIterator
+}
+
+func (s spannerRowIterator) Metadata() *v1.ResultSetMetadata {
+	return s.RowIterator.Metadata
+}
+
+func (s spannerRowIterator) QueryStats() map[string]interface{} {
+	return s.RowIterator.QueryStats
+}
+
+// a nextable that can report the execution statistics of its query,
+// once all of its rows have been read
+type statsNextable interface {
+	QueryStats() map[string]interface{}
+}
@@ -31,12 +31,14 @@
 package sqlspanner_test
 
 import (
+	"database/sql"
 	"database/sql/driver"
 	"io"
+	"reflect"
 	//"fmt"
+	"cloud.google.com/go/spanner"
 	"github.com/Sirupsen/logrus"
 	"github.com/tcncloud/sqlspanner"
-	//"cloud.google.com/go/spanner"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -69,6 +71,27 @@ var _ = Describe("Rows", func() {
 					Expect(err).To(BeEquivalentTo(io.EOF))
 				})
 			})
+			Describe("with empty iterator that has metadata", func() {
+				next := sqlspanner.NewTestMetadataNextable(0, "values")
+				rows := sqlspanner.NewRowsFromNextable(next)
+				It("has columns", func() {
+					Expect(rows.Columns()).To(BeEquivalentTo([]string{
+						"a", "b", "c", "d", "e",
+						"f", "g", "h", "i", "j",
+					}))
+				})
+
+				It("has column types", func() {
+					Expect(rows.ColumnTypeDatabaseTypeName(0)).To(Equal("BOOL"))
+					Expect(rows.ColumnTypeDatabaseTypeName(9)).To(Equal("ARRAY<BYTES>"))
+				})
+
+				It("sets err field to io.EOF", func() {
+					row := make([]driver.Value, 10)
+					err := rows.Next(row)
+					Expect(err).To(BeEquivalentTo(io.EOF))
+				})
+			})
 			Describe("with full iterator", func() {
 				Describe(`with values that are types:
 						string, int64, float64, []byte, bool, []bool, []int64, []float64, []string, [][]byte`, func() {
@@ -81,6 +104,24 @@ var _ = Describe("Rows", func() {
 						}))
 					})
 
+					It("has column types", func() {
+						names := make([]string, 10)
+						for i := range names {
+							names[i] = rows.ColumnTypeDatabaseTypeName(i)
+						}
+						Expect(names).To(BeEquivalentTo([]string{
+							"BOOL", "INT64", "FLOAT64", "STRING", "BYTES",
+							"ARRAY<BOOL>", "ARRAY<INT64>", "ARRAY<FLOAT64>", "ARRAY<STRING>", "ARRAY<BYTES>",
+						}))
+						Expect(rows.ColumnTypeScanType(1)).To(Equal(reflect.TypeOf(spanner.NullInt64{})))
+						Expect(rows.ColumnTypeScanType(6)).To(Equal(reflect.TypeOf([]spanner.NullInt64{})))
+						Expect(rows.ColumnTypeScanType(9)).To(Equal(reflect.TypeOf([][]byte{})))
+						_, ok := rows.ColumnTypeLength(1)
+						Expect(ok).To(BeFalse())
+						_, ok = rows.ColumnTypeLength(3)
+						Expect(ok).To(BeTrue())
+					})
+
 					It("gets correct []driver.Value for number of rows that are in iterator", func() {
 						for i := 0; i < 2; i++ {
 							row := make([]driver.Value, 10)
@@ -95,6 +136,52 @@ var _ = Describe("Rows", func() {
 					})
 				})
 
+				Describe(`with values that are types: *big.Rat, spanner.NullNumeric, []*big.Rat, spanner.NullJSON, []spanner.NullJSON`, func() {
+					next := sqlspanner.NewTestNextable(2, "numerics")
+					rows := sqlspanner.NewRowsFromNextable(next)
+					It("gets correct []driver.Value for number of rows that are in iterator", func() {
+						for i := 0; i < 2; i++ {
+							row := make([]driver.Value, 6)
+							err := rows.Next(row)
+							Expect(err).To(BeZero())
+							Expect(row).To(BeEquivalentTo(next.WhatNumericRowShouldBe()))
+						}
+						row := make([]driver.Value, 6)
+						err := rows.Next(row)
+						Expect(err).To(BeEquivalentTo(io.EOF))
+					})
+				})
+
+				Describe("with the standard result mode", func() {
+					It("gets standard driver.Values for scalars and []interface{} for arrays", func() {
+						next := sqlspanner.NewTestNextable(1, "values")
+						rows := sqlspanner.NewStandardRowsFromNextable(next)
+						row := make([]driver.Value, 10)
+						err := rows.Next(row)
+						Expect(err).To(BeZero())
+						Expect(row).To(BeEquivalentTo(next.WhatStandardValueRowShouldBe()))
+					})
+
+					It("has scan types that hold the standard values", func() {
+						rows := sqlspanner.NewStandardRowsFromNextable(sqlspanner.NewTestNextable(1, "values"))
+						Expect(rows.ColumnTypeScanType(0)).To(Equal(reflect.TypeOf(sql.NullBool{})))
+						Expect(rows.ColumnTypeScanType(1)).To(Equal(reflect.TypeOf(sql.NullInt64{})))
+						Expect(rows.ColumnTypeScanType(3)).To(Equal(reflect.TypeOf(sql.NullString{})))
+						Expect(rows.ColumnTypeScanType(4)).To(Equal(reflect.TypeOf([]byte{})))
+						Expect(rows.ColumnTypeScanType(6)).To(Equal(reflect.TypeOf([]interface{}{})))
+						Expect(rows.ColumnTypeScanType(9)).To(Equal(reflect.TypeOf([]interface{}{})))
+					})
+
+					It("gets nil for NULL values", func() {
+						next := sqlspanner.NewTestNextable(1, "numerics")
+						rows := sqlspanner.NewStandardRowsFromNextable(next)
+						row := make([]driver.Value, 6)
+						err := rows.Next(row)
+						Expect(err).To(BeZero())
+						Expect(row).To(BeEquivalentTo(next.WhatStandardNumericRowShouldBe()))
+					})
+				})
+
 				Describe(`with values that are types: civil.Date, time.Time, []civil.Date, []time.Time`, func() {
 					next := sqlspanner.NewTestNextable(2, "times")
 					rows := sqlspanner.NewRowsFromNextable(next)
@@ -0,0 +1,102 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package sqlspanner
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/option"
+)
+
+// Endpoint is where the database of a data source name with a registered scheme is served
+type Endpoint struct {
+	// the database's path, like projects/p/instances/i/databases/d
+	Database string
+	Options  []option.ClientOption
+	// set for databases without an INFORMATION_SCHEMA, like the fake package's.
+	// Selects on them are always queried, instead of read by key
+	NoInformationSchema bool
+}
+
+// the registered schemes, by name
+var (
+	schemesMu sync.Mutex
+	schemes   = make(map[string]func(name string) (*Endpoint, error))
+)
+
+// RegisterScheme makes data source names like <scheme>://<name> connect to the
+// Endpoint resolve returns for name. The fake package registers fake://
+func RegisterScheme(scheme string, resolve func(name string) (*Endpoint, error)) {
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+	if _, ok := schemes[scheme]; ok {
+		panic("sqlspanner: scheme " + scheme + " is already registered")
+	}
+	schemes[scheme] = resolve
+}
+
+// the endpoint of cfg's database. Database paths without a scheme are spanner's
+func endpoint(cfg *Config) (*Endpoint, error) {
+	i := strings.Index(cfg.Database, "://")
+	if i < 0 {
+		return &Endpoint{Database: cfg.Database}, nil
+	}
+	scheme := cfg.Database[:i]
+	schemesMu.Lock()
+	resolve := schemes[scheme]
+	schemesMu.Unlock()
+	if resolve == nil {
+		return nil, fmt.Errorf("unknown data source name scheme %q, the package registering it has to be imported", scheme)
+	}
+	return resolve(cfg.Database[i+len("://"):])
+}
+
+func (c *conn) HasInformationSchema() bool {
+	return !c.noInformationSchema
+}
+
+// HasInformationSchema reports whether the database of c has an INFORMATION_SCHEMA
+// to look tables and columns up in. The fake package's databases do not
+func HasInformationSchema(c *sql.Conn) (bool, error) {
+	var has bool
+	err := c.Raw(func(driverConn interface{}) error {
+		sc, ok := driverConn.(SpannerConn)
+		if !ok {
+			return fmt.Errorf("not a spanner connection: %T", driverConn)
+		}
+		has = sc.HasInformationSchema()
+		return nil
+	})
+	return has, err
+}
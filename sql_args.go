@@ -34,7 +34,9 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"strconv"
+	"strings"
 
+	"cloud.google.com/go/spanner"
 	"github.com/xwb1989/sqlparser"
 )
 
@@ -50,10 +52,8 @@ type ArgPlaceholder struct {
 func (a *Args) ParseValExpr(expr sqlparser.ValExpr) (interface{}, error) {
 	switch value := expr.(type) {
 	case sqlparser.StrVal: // a quoted string
-		fmt.Printf("StrVal %+v\n", value)
 		return string(value[:]), nil
 	case sqlparser.NumVal:
-		fmt.Printf("NumVal %+v\n", value)
 		rv, err := strconv.ParseInt(string(value[:]), 10, 64)
 		if err != nil {
 			rv, err := strconv.ParseFloat(string(value[:]), 64)
@@ -70,24 +70,136 @@ func (a *Args) ParseValExpr(expr sqlparser.ValExpr) (interface{}, error) {
 		return val, nil
 	case *sqlparser.NullVal:
 		return nil, nil
-	case *sqlparser.ColName:
-		fmt.Printf("ColName %+v\n", value)
-	case sqlparser.ValTuple:
-		fmt.Printf("ValTuple %+v\n", value)
-	case *sqlparser.Subquery:
-		fmt.Printf("Subquery %+v\n", value)
-	case sqlparser.ListArg:
-		fmt.Printf("ListArg %+v\n", value)
-	case *sqlparser.BinaryExpr:
-		fmt.Printf("BinaryExpr %+v\n", value)
-	case *sqlparser.UnaryExpr:
-		fmt.Printf("UnaryExpr %+v\n", value)
 	case *sqlparser.FuncExpr:
-		fmt.Printf("FuncExpr %+v\n", value)
-	case *sqlparser.CaseExpr:
-		fmt.Printf("CaseExpr %+v\n", value)
+		// spanner fills the column with the transaction's commit time
+		if strings.EqualFold(string(value.Name), "PENDING_COMMIT_TIMESTAMP") {
+			if len(value.Exprs) != 0 {
+				return nil, fmt.Errorf("PENDING_COMMIT_TIMESTAMP does not take any arguments")
+			}
+			return spanner.CommitTimestamp, nil
+		}
+	}
+	return nil, &UnsupportedSQLError{Construct: nodeName(expr) + " values"}
+}
+
+// a spanner statement requires @ prefixed named params instead of the sql driver's ?.
+// Takes a query like: SELECT * FROM example_table WHERE a=?  OR b=? OR c=5
+// and turns it into: SELECT * FROM example_table WHERE a=@p0 OR b=@p1 OR c=5
+// returning the new query, and the args it expects keyed by param name.
+// spanner param names cannot start with a digit, so they are prefixed with p.
+// A ? in a string, a quoted identifier, or a comment is left alone
+func toNamedParams(query string) (string, *partialArgMap) {
+	var updated strings.Builder
+	pArgMap := newPartialArgMap()
+	count := 0
+	for i := 0; i < len(query); {
+		if n := skipLiteral(query, i); n > i {
+			updated.WriteString(query[i:n])
+			i = n
+			continue
+		}
+		if query[i] == '?' {
+			name := fmt.Sprintf("p%d", count)
+			updated.WriteString("@" + name)
+			pArgMap.AddArg(name, ArgPlaceholder{queuePos: count})
+			count++
+		} else {
+			updated.WriteByte(query[i])
+		}
+		i++
+	}
+	return updated.String(), pArgMap
+}
+
+// returns where the string, quoted identifier, or comment starting at i ends,
+// or i when there isn't one
+func skipLiteral(query string, i int) int {
+	end, _ := literalEnd(query, i)
+	return end
+}
+
+// returns where the string, quoted identifier, or comment starting at i ends, i when
+// there isn't one, and whether it is terminated. Unterminated ones end the query
+func literalEnd(query string, i int) (int, bool) {
+	rest := query[i:]
+	switch {
+	case strings.HasPrefix(rest, "--"), rest[0] == '#':
+		if end := strings.IndexByte(rest, '\n'); end >= 0 {
+			return i + end + 1, true
+		}
+		return len(query), false
+	case strings.HasPrefix(rest, "/*"):
+		if end := strings.Index(rest[2:], "*/"); end >= 0 {
+			return i + 2 + end + 2, true
+		}
+		return len(query), false
+	case strings.HasPrefix(rest, "'''"), strings.HasPrefix(rest, `"""`):
+		if end := strings.Index(rest[3:], rest[:3]); end >= 0 {
+			return i + 3 + end + 3, true
+		}
+		return len(query), false
+	case rest[0] == '\'', rest[0] == '"', rest[0] == '`':
+		for j := 1; j < len(rest); j++ {
+			switch rest[j] {
+			case '\\':
+				j++
+			case rest[0]:
+				return i + j + 1, true
+			}
+		}
+		return len(query), false
+	}
+	return i, true
+}
+
+// SplitStatements splits a script on the semicolons that end its statements, skipping
+// semicolons in strings, quoted identifiers, and comments. It returns the statements,
+// without empty ones or ones that are only comments, and the rest of the script after
+// the last semicolon, which is a statement that has not been ended yet
+//   stmts, rest := sqlspanner.SplitStatements("CREATE TABLE a (...); SELECT ';'")
+//   // stmts is ["CREATE TABLE a (...)"], rest is " SELECT ';'"
+func SplitStatements(script string) ([]string, string) {
+	var stmts []string
+	start := 0
+	for i := 0; i < len(script); {
+		if end, terminated := literalEnd(script, i); end > i {
+			if !terminated {
+				// a statement with an unterminated string or comment has not ended
+				return stmts, script[start:]
+			}
+			i = end
+			continue
+		}
+		if script[i] == ';' {
+			if stmt := strings.TrimSpace(script[start:i]); !onlyComments(stmt) {
+				stmts = append(stmts, stmt)
+			}
+			start = i + 1
+		}
+		i++
+	}
+	return stmts, script[start:]
+}
+
+// reports whether stmt has nothing but whitespace and comments in it
+func onlyComments(stmt string) bool {
+	return leadingComments(stmt) == len(stmt)
+}
+
+// returns where stmt starts after the whitespace and comments in front of it
+func leadingComments(stmt string) int {
+	for i := 0; i < len(stmt); {
+		if strings.IndexByte(" \t\r\n", stmt[i]) >= 0 {
+			i++
+			continue
+		}
+		rest := stmt[i:]
+		if !strings.HasPrefix(rest, "--") && rest[0] != '#' && !strings.HasPrefix(rest, "/*") {
+			return i
+		}
+		i = skipLiteral(stmt, i)
 	}
-	return nil, fmt.Errorf("unsupported value expression")
+	return len(stmt)
 }
 
 type partialArgSlice struct {
@@ -36,7 +36,8 @@ import (
 	"database/sql/driver"
 	"fmt"
 	"github.com/xwb1989/sqlparser"
-	"strings"
+	"sort"
+	v1 "google.golang.org/genproto/googleapis/spanner/v1"
 )
 
 type stmt struct {
@@ -49,12 +50,53 @@ type stmt struct {
 	partialArgs     interface{}
 	tce             *typeCacheEncoder
 	currentCol      int
+	queryMode       *v1.ExecuteSqlRequest_QueryMode // set for EXPLAIN, and EXPLAIN ANALYZE
+	ddl             string                          // set for DDL statements, they are not parsed
+	batchCmd        batchCommand                    // set for START BATCH, RUN BATCH, and ABORT BATCH
+	dmlQuery        string                          // the insert/update/delete query with named params, for DML batches
+	dmlParams       *partialArgMap
+	dmlMode         *AutocommitDMLMode // set for SET AUTOCOMMIT_DML_MODE
+	mutationErr     error              // why an update or delete cannot be applied as a mutation, it can still run as DML
+	lookup          *pointLookup       // set for selects that may be read by primary key
+	rawSelect       bool               // set for queries the parser could not parse, they have no parsedStatement
+	readsPartition  bool               // set for RUN PARTITION
+	partition       string             // the partition given in a RUN PARTITION statement, instead of as an arg
 }
 
 func newStmt(query string, c *conn) (driver.Stmt, error) {
-	pstmt, err := sqlparser.Parse(query)
+	if cmd := parseBatchCommand(query); cmd != batchNone {
+		return &stmt{conn: c, origQuery: query, batchCmd: cmd, tce: newTypeCacheEncoder(), currentCol: -1}, nil
+	}
+	if ok, partition := parseRunPartition(query); ok {
+		return &stmt{conn: c, origQuery: query, readsPartition: true, partition: partition, tce: newTypeCacheEncoder(), currentCol: -1}, nil
+	}
+	if mode, ok, err := parseSetDMLMode(query); ok {
+		if err != nil {
+			return nil, err
+		}
+		return &stmt{conn: c, origQuery: query, dmlMode: mode, tce: newTypeCacheEncoder(), currentCol: -1}, nil
+	}
+	if IsDDL(query) {
+		return &stmt{conn: c, origQuery: query, ddl: query, tce: newTypeCacheEncoder(), currentCol: -1}, nil
+	}
+	queryMode, query := explainMode(query)
+	unhinted, hints, err := stripHints(query)
+	var pstmt sqlparser.Statement
+	if err == nil {
+		pstmt, err = sqlparser.Parse(unhinted)
+	}
 	if err != nil {
-		return nil, err
+		// the mysql parser does not know most of spanner's sql, queries it
+		// cannot parse are sent to spanner as they are
+		if isSelect(query) {
+			st := &stmt{conn: c, origQuery: query, rawSelect: true, tce: newTypeCacheEncoder(), currentCol: -1, queryMode: queryMode}
+			st.updatedQuery, st.partialArgs = toNamedParams(query)
+			return st, nil
+		}
+		return nil, newParseError(query, err)
+	}
+	if _, ok := pstmt.(*sqlparser.Select); queryMode != nil && !ok {
+		return nil, fmt.Errorf("only SELECT statements can be explained")
 	}
 	st := &stmt{
 		conn:            c,
@@ -65,6 +107,7 @@ func newStmt(query string, c *conn) (driver.Stmt, error) {
 		tce:             newTypeCacheEncoder(),
 		// the current col in the row we are editing
 		currentCol:      -1,
+		queryMode:       queryMode,
 	}
 	switch s := pstmt.(type) {
 	case *sqlparser.Insert:
@@ -84,37 +127,35 @@ func newStmt(query string, c *conn) (driver.Stmt, error) {
 		st.tableName = tableName
 		st.columnNames = columnNames
 	case *sqlparser.Update:
-		pArgMap, err := extractUpdateClause(s)
-		if err != nil {
-			return nil, err
-		}
 		tableName, err := extractIUDTableName(s)
 		if err != nil {
 			return nil, err
 		}
-		st.partialArgs = pArgMap
 		st.tableName = tableName
-	case *sqlparser.Delete:
-		mkr, err := extractSpannerKeyFromDelete(s)
+		// updates that are not on a primary key can still run as partitioned, or batched dml
+		pArgMap, err := extractUpdateClause(s)
 		if err != nil {
-			return nil, err
+			st.mutationErr = err
+		} else {
+			st.partialArgs = pArgMap
 		}
+	case *sqlparser.Delete:
 		tableName, err := extractIUDTableName(s)
 		if err != nil {
 			return nil, err
 		}
-		st.partialArgs = mkr
 		st.tableName = tableName
+		mkr, err := extractSpannerKeyFromDelete(s)
+		if err != nil {
+			st.mutationErr = err
+		} else {
+			st.partialArgs = mkr
+		}
 	case *sqlparser.Select:
-		pArgMap := newPartialArgMap()
-		spl := strings.Split(query, "?")
-		for i := 0; i < len(spl)-1; i++ {
-			namedIndex := fmt.Sprintf("@%d", i)
-			st.updatedQuery += (spl[i] + namedIndex)
-			pArgMap.AddArg(namedIndex, ArgPlaceholder{queuePos: i})
+		st.updatedQuery, st.partialArgs = toNamedParams(query)
+		if queryMode == nil {
+			st.lookup = extractPointLookup(s, hints)
 		}
-		st.updatedQuery += spl[len(spl)-1]
-		st.partialArgs = pArgMap
 	}
 	return st, nil
 }
@@ -133,12 +174,43 @@ func (s *stmt) ConvertValue(v interface{}) (driver.Value, error) {
 		return nil, fmt.Errorf("cannot call ConvertValue without setting ColumnConvert index")
 	}
 	if IsValue(v) {
-		if needsEncoding(v) {
-			return s.tce.encodeCol(s.currentCol, v)
+		converted, err := toJSONValue(v)
+		if err != nil {
+			return nil, &ConversionError{Column: s.argColumn(), Type: fmt.Sprintf("%T", v), Err: err}
+		}
+		if isCommitTimestamp(converted) {
+			return spanner.CommitTimestamp, nil
 		}
-		return v, nil
+		if needsEncoding(converted) {
+			return s.tce.encodeCol(s.currentCol, converted)
+		}
+		return converted, nil
 	}
-	return nil, fmt.Errorf("value will not fit in spanner %#v", v)
+	return nil, &ConversionError{Column: s.argColumn(), Type: fmt.Sprintf("%T", v), Err: fmt.Errorf("value will not fit in spanner %#v", v)}
+}
+
+// implements driver.NamedValueChecker. database/sql turns args that are driver.Valuers
+// into their Value before ConvertValue sees them, and spanner.NullDate and NullNumeric
+// values are not driver.Values, so spanner's types are converted as they are. Other
+// args are left to database/sql
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if !isSpannerValue(nv.Value) {
+		return driver.ErrSkip
+	}
+	v, err := s.ColumnConverter(nv.Ordinal - 1).ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value = v
+	return nil
+}
+
+// the column the current arg is written to for inserts, or its position
+func (s *stmt) argColumn() string {
+	if s.currentCol < len(s.columnNames) {
+		return s.columnNames[s.currentCol]
+	}
+	return fmt.Sprintf("arg %d", s.currentCol+1)
 }
 
 // a statement doesnt have to do anything special to close it
@@ -151,11 +223,60 @@ func (s *stmt) NumInput() int {
 }
 
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
-	fmt.Printf("args now: %+v", args)
+	if s.conn.bad {
+		return nil, driver.ErrBadConn
+	}
+	res, err := s.exec(args)
+	if r, ok := res.(*result); ok && s.conn.dryRun {
+		r.planned = s.conn.planned
+	}
+	return res, s.conn.checkBadConn(err)
+}
+
+func (s *stmt) exec(args []driver.Value) (driver.Result, error) {
 	args, err := s.getCachedArgs(args)
 	if err != nil {
 		return nil, err
 	}
+	s.conn.commitTimestamp = nil
+	s.conn.planned = nil
+	if s.batchCmd != batchNone {
+		return s.conn.execBatchCommand(context.Background(), s.batchCmd)
+	}
+	if s.dmlMode != nil {
+		rowsAffected := int64(0)
+		return &result{rowsAffected: &rowsAffected}, s.conn.SetAutocommitDMLMode(*s.dmlMode)
+	}
+	if kind := s.writeKind(); kind != "" && s.conn.cfg.ReadOnly {
+		return nil, &ReadOnlyError{Statement: kind}
+	}
+	if s.ddl != "" {
+		return s.conn.queueOrExecDDL(context.Background(), s.ddl)
+	}
+	if s.conn.batch != nil {
+		switch s.parsedStatement.(type) {
+		case *sqlparser.Insert, *sqlparser.Update, *sqlparser.Delete:
+			if s.conn.batch.kind == batchKindDML {
+				return s.conn.queueDML(s, args)
+			}
+		}
+		if s.conn.batch.kind == batchKindDDL {
+			return nil, fmt.Errorf("only DDL statements can be run in a DDL batch")
+		}
+		return nil, fmt.Errorf("only INSERT, UPDATE, and DELETE statements can be run in a DML batch")
+	}
+	// statements in a transaction are always buffered as mutations
+	if s.conn.tx == nil && s.conn.dmlMode == AutocommitDMLModePartitionedNonAtomic {
+		switch s.parsedStatement.(type) {
+		case *sqlparser.Update, *sqlparser.Delete:
+			return s.executePartitionedDML(context.Background(), args)
+		case *sqlparser.Insert:
+			return nil, fmt.Errorf("INSERT statements cannot be run in %v mode", AutocommitDMLModePartitionedNonAtomic)
+		}
+	}
+	if s.mutationErr != nil {
+		return nil, s.mutationErr
+	}
 	switch s.parsedStatement.(type) {
 	case *sqlparser.Insert:
 		return s.executeInsertQuery(args)
@@ -169,19 +290,59 @@ func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
 }
 
 
+// the kind of write the statement makes, or "" when it does not write
+func (s *stmt) writeKind() string {
+	if s.ddl != "" {
+		return "DDL"
+	}
+	switch s.parsedStatement.(type) {
+	case *sqlparser.Insert:
+		return "INSERT"
+	case *sqlparser.Update:
+		return "UPDATE"
+	case *sqlparser.Delete:
+		return "DELETE"
+	}
+	return ""
+}
+
 // creates a spanner statement out of the given query string and and array of driver values
 // a spanner statment requires a Query with @ prefixed named args, instead of sql drivers ?
 // and for params it requires a map[string]interface{} intead of []driver.Value
 // Takes a query like: SELECT * FROM example_table WHERE a=?  OR b=? OR c=5
-// and turns it into: SELECT * FROM example_table WHERE a=@1 OR b=@2 OR c=5
+// and turns it into: SELECT * FROM example_table WHERE a=@p0 OR b=@p1 OR c=5
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	if s.conn.bad {
+		return nil, driver.ErrBadConn
+	}
+	r, err := s.query(args)
+	if err != nil {
+		return nil, s.conn.checkBadConn(err)
+	}
+	// rows read their first row when they are created, queries are safe to run
+	// again when spanner rejected that read
+	if isBadConn(r.err) {
+		return nil, s.conn.checkBadConn(r.err)
+	}
+	return r, nil
+}
+
+func (s *stmt) query(args []driver.Value) (*rows, error) {
 	args, err := s.getCachedArgs(args)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("args now: %+v\n", args)
+	if s.readsPartition {
+		r, err := s.runPartition(context.Background(), args)
+		if err != nil {
+			return nil, err
+		}
+		r.valuer.mode = s.conn.cfg.ResultMode
+		s.conn.lastRows = r
+		return r, nil
+	}
 	_, ok := s.parsedStatement.(*sqlparser.Select)
-	if !ok {
+	if !ok && !s.rawSelect {
 		return nil, fmt.Errorf("not a query-able query (not a select statment)")
 	}
 	pArgMap, ok := s.partialArgs.(*partialArgMap)
@@ -193,15 +354,47 @@ func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
 		return nil, err
 	}
 	spannerStmt := spanner.Statement{SQL: s.updatedQuery, Params: argsMap}
-	iter := s.conn.client.Single().Query(context.Background(), spannerStmt)
+	var r *rows
+	var iter *spanner.RowIterator
+	read := false
+	// stats are only collected by the query engine
+	if s.lookup != nil && !s.conn.cfg.QueryStats {
+		iter, read, err = s.lookup.read(context.Background(), s.conn, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if read {
+		r = newRowsFromSpannerIterator(iter)
+	} else if s.queryMode != nil {
+		r, err = s.explainQuery(context.Background(), spannerStmt)
+		if err != nil {
+			return nil, err
+		}
+	} else if s.conn.cfg.QueryStats {
+		iter := s.conn.client.Single().QueryWithStats(context.Background(), spannerStmt)
+		r = newRowsFromSpannerIterator(iter)
+	} else {
+		iter := s.conn.client.Single().Query(context.Background(), spannerStmt)
+		r = newRowsFromSpannerIterator(iter)
+	}
+	r.valuer.mode = s.conn.cfg.ResultMode
+	s.conn.lastRows = r
+	return r, nil
+}
 
-	return newRowsFromSpannerIterator(iter), nil
+// the insert/update/delete query's args, when it is sent to spanner as DML
+// instead of being turned into a mutation
+func (s *stmt) dmlArgs() *partialArgMap {
+	if s.dmlParams == nil {
+		s.dmlQuery, s.dmlParams = toNamedParams(s.origQuery)
+	}
+	return s.dmlParams
 }
 
 // pull out the args that are stored in stmt's typeCacheEncoder by the ConvertValue  function
 //  driver.Statements are not used by multiple go routines concurrently
 func (s *stmt) getCachedArgs(args []driver.Value) ([]driver.Value, error) {
-	fmt.Println("in cached args")
 	if s.currentCol != -1 {
 		for i := 0; i < len(args); i++ {
 			if bs, ok := args[i].([]byte); ok && s.tce.haveCol(i){
@@ -209,10 +402,7 @@ func (s *stmt) getCachedArgs(args []driver.Value) ([]driver.Value, error) {
 				if err != nil {
 					return nil, err
 				}
-				fmt.Printf("converting args[%d] to %+v\n", i, arg)
 				args[i] = arg
-			} else {
-				fmt.Printf("already have arg[%d]: %#v\n", i, args[i])
 			}
 		}
 		s.currentCol = -1
@@ -229,14 +419,31 @@ func (s *stmt) executeUpdateQuery(providedArgs []driver.Value) (driver.Result, e
 	if err != nil {
 		return nil, err
 	}
-	muts := make([]*spanner.Mutation, 1)
-	muts[0] = spanner.UpdateMap(s.tableName, argsMap)
-	_, err = s.conn.client.Apply(context.Background(), muts)
+	cols := make([]string, 0, len(argsMap))
+	for col := range argsMap {
+		cols = append(cols, col)
+	}
+	sort.Strings(cols)
+	vals := make([]interface{}, len(cols))
+	for i, col := range cols {
+		vals[i] = argsMap[col]
+	}
+	commitTimestamp, err := s.conn.write(context.Background(), &PlannedWrite{
+		Op:       "UPDATE",
+		Table:    s.tableName,
+		Columns:  cols,
+		Values:   vals,
+		Mutation: spanner.Update(s.tableName, cols, vals),
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	rowsAffected := int64(1)
 	return &result{
-		lastID:       nil,
-		rowsAffected: &rowsAffected,
+		lastID:          nil,
+		rowsAffected:    &rowsAffected,
+		commitTimestamp: commitTimestamp,
 	}, nil
 }
 
@@ -245,21 +452,28 @@ func (s *stmt) executeDeleteQuery(providedArgs []driver.Value) (driver.Result, e
 	if !ok {
 		return nil, fmt.Errorf("partialArgs was not a *MergableKeyRange.  Instead: %#v", s.partialArgs)
 	}
+	if !mkr.bounded() && !s.conn.cfg.AllowUnboundedWrites {
+		return nil, &UnboundedWriteError{Statement: "DELETE", Table: s.tableName}
+	}
 	keyRange, err := mkr.ToKeyRange(providedArgs)
 	if err != nil {
 		return nil, err
 	}
-	muts := make([]*spanner.Mutation, 1)
-	muts[0] = spanner.DeleteKeyRange(s.tableName, *keyRange)
-	_, err = s.conn.client.Apply(context.Background(), muts)
+	commitTimestamp, err := s.conn.write(context.Background(), &PlannedWrite{
+		Op:       "DELETE",
+		Table:    s.tableName,
+		Keys:     *keyRange,
+		Mutation: spanner.Delete(s.tableName, *keyRange),
+	})
 	if err != nil {
 		return nil, err
 	}
 	// TODO: find actual number of rows affected
 	rowsAffected := int64(1)
 	return &result{
-		lastID:       nil,
-		rowsAffected: &rowsAffected,
+		lastID:          nil,
+		rowsAffected:    &rowsAffected,
+		commitTimestamp: commitTimestamp,
 	}, nil
 }
 
@@ -272,18 +486,22 @@ func (s *stmt) executeInsertQuery(providedArgs []driver.Value) (driver.Result, e
 	if err != nil {
 		return nil, err
 	}
-	// create a spanner mutation for the insert query
-	muts := make([]*spanner.Mutation, 1)
-	muts[0] = spanner.Insert(s.tableName, s.columnNames, args)
 	// should probably support different contexts for querying spanner, inserts, deletes, and updates are slow
-	_, err = s.conn.client.Apply(context.Background(), muts)
+	commitTimestamp, err := s.conn.write(context.Background(), &PlannedWrite{
+		Op:       "INSERT",
+		Table:    s.tableName,
+		Columns:  s.columnNames,
+		Values:   args,
+		Mutation: spanner.Insert(s.tableName, s.columnNames, args),
+	})
 	if err != nil {
 		return nil, err
 	}
 	//TODO:  find the last inserted id, and put it on the result
 	rowsAffected := int64(1)
 	return &result{
-		lastID:       nil,
-		rowsAffected: &rowsAffected,
+		lastID:          nil,
+		rowsAffected:    &rowsAffected,
+		commitTimestamp: commitTimestamp,
 	}, nil
 }
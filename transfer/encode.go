@@ -0,0 +1,188 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package transfer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tcncloud/sqlspanner"
+)
+
+// encodes a value read from a column of type typ as a CSV field. Scalars are written
+// as they are in JSONL, without the quotes, and everything else as json text.
+// A STRING that is exactly \N can not be told apart from NULL
+func encodeCSV(v interface{}, typ string) (string, error) {
+	val, err := encodeJSON(v, typ)
+	if err != nil {
+		return "", err
+	}
+	switch t := val.(type) {
+	case nil:
+		return CSVNull, nil
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'g', -1, 64), nil
+	}
+	b, err := json.Marshal(val)
+	return string(b), err
+}
+
+// converts a value read from a column of type typ into the value json.Marshal
+// writes to JSONL
+func encodeJSON(v interface{}, typ string) (interface{}, error) {
+	std, err := sqlspanner.StandardValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonValue(std, typ)
+}
+
+func jsonValue(v interface{}, typ string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if elem, ok := arrayElem(typ); ok {
+		vals, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("expected an array for %s, got %T", typ, v)
+		}
+		out := make([]interface{}, len(vals))
+		for i, e := range vals {
+			val, err := jsonValue(e, elem)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	}
+	if fields, ok := structFields(typ); ok {
+		// structs are written as an array of their fields' values
+		vals, ok := v.([]interface{})
+		if !ok || len(vals) != len(fields) {
+			return nil, fmt.Errorf("expected %d fields for %s, got %#v", len(fields), typ, v)
+		}
+		out := make([]interface{}, len(vals))
+		for i, e := range vals {
+			val, err := jsonValue(e, fields[i])
+			if err != nil {
+				return nil, err
+			}
+			out[i] = val
+		}
+		return out, nil
+	}
+	switch t := v.(type) {
+	case float64:
+		switch {
+		case math.IsNaN(t):
+			return "NaN", nil
+		case math.IsInf(t, 1):
+			return "Infinity", nil
+		case math.IsInf(t, -1):
+			return "-Infinity", nil
+		}
+		return t, nil
+	case time.Time:
+		if typ == "DATE" {
+			return t.Format("2006-01-02"), nil
+		}
+		return t.UTC().Format(time.RFC3339Nano), nil
+	case []byte:
+		if typ == "JSON" {
+			if !json.Valid(t) {
+				return nil, fmt.Errorf("invalid json %q", t)
+			}
+			return json.RawMessage(t), nil
+		}
+		return base64.StdEncoding.EncodeToString(t), nil
+	}
+	// bools, int64s, strings and NUMERIC strings are written as they are
+	return v, nil
+}
+
+// returns the element type of an ARRAY<T> type name
+func arrayElem(typ string) (string, bool) {
+	if !strings.HasPrefix(typ, "ARRAY<") || !strings.HasSuffix(typ, ">") {
+		return "", false
+	}
+	return typ[len("ARRAY<") : len(typ)-1], true
+}
+
+// returns the field types of a STRUCT<name T, ...> type name
+func structFields(typ string) ([]string, bool) {
+	if !strings.HasPrefix(typ, "STRUCT<") || !strings.HasSuffix(typ, ">") {
+		return nil, false
+	}
+	inner := typ[len("STRUCT<") : len(typ)-1]
+	var fields []string
+	depth, start := 0, 0
+	for i := 0; i <= len(inner); i++ {
+		if i < len(inner) {
+			switch inner[i] {
+			case '<':
+				depth++
+				continue
+			case '>':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		field := strings.TrimSpace(inner[start:i])
+		start = i + 1
+		if field == "" {
+			continue
+		}
+		// unnamed fields have only a type, and types have no spaces before their <
+		if sp := strings.IndexByte(field, ' '); sp >= 0 && (strings.IndexByte(field, '<') < 0 || sp < strings.IndexByte(field, '<')) {
+			field = strings.TrimSpace(field[sp+1:])
+		}
+		fields = append(fields, field)
+	}
+	return fields, true
+}
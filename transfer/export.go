@@ -0,0 +1,211 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+// Package transfer exports tables and queries from spanner to CSV or JSONL, and imports
+// CSV or JSONL files into tables, through the sqlspanner driver. Every spanner type is
+// written so it is read back as the same value. NULL is null in JSONL, and \N in CSV.
+// BYTES are base64, DATEs are 2006-01-02, and TIMESTAMPs are RFC 3339 in UTC. NUMERICs
+// are strings so they keep their precision, and so are FLOAT64 NaN, Infinity and
+// -Infinity. JSON values and arrays are json, and in CSV the json text
+//
+//   n, err := transfer.ExportTable(ctx, db, w, transfer.CSV, "users")
+//   n, err = transfer.Import(ctx, conn, r, transfer.CSV, "users", nil)
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format is a file format rows are exported to, and imported from
+type Format int
+
+const (
+	// CSV has a header of column names, and a record for each row
+	CSV Format = iota + 1
+	// JSONL has a json object on each line for each row, keyed by column name
+	JSONL
+)
+
+// CSVNull is the CSV field of a NULL value, an empty field is an empty string
+const CSVNull = `\N`
+
+func (f Format) String() string {
+	switch f {
+	case CSV:
+		return "csv"
+	case JSONL:
+		return "jsonl"
+	}
+	return fmt.Sprintf("Format(%d)", int(f))
+}
+
+// ParseFormat returns the format named csv, or jsonl
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "csv":
+		return CSV, nil
+	case "jsonl", "ndjson":
+		return JSONL, nil
+	}
+	return 0, fmt.Errorf("unknown format %q, use csv or jsonl", name)
+}
+
+// FormatOf returns the format of a file by its extension, .jsonl and .ndjson
+// files are JSONL, and everything else is CSV
+func FormatOf(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return JSONL
+	}
+	return CSV
+}
+
+// Querier runs the export's query, it is a *sql.DB, *sql.Conn, or *sql.Tx
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ExportTable writes every row of table to w, and returns the number of rows written
+func ExportTable(ctx context.Context, q Querier, w io.Writer, format Format, table string) (int64, error) {
+	return Export(ctx, q, w, format, fmt.Sprintf("SELECT * FROM %s", quoteIdent(table)))
+}
+
+// Export writes the rows of a query to w as they are read, and returns the number
+// of rows written. The rows can be read in either of the driver's result modes
+func Export(ctx context.Context, q Querier, w io.Writer, format Format, query string, args ...interface{}) (int64, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	names := make([]string, len(types))
+	typeNames := make([]string, len(types))
+	for i, t := range types {
+		names[i] = t.Name()
+		typeNames[i] = t.DatabaseTypeName()
+	}
+
+	var writeRow func(values []interface{}) error
+	var flush func() error
+	switch format {
+	case CSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(names); err != nil {
+			return 0, err
+		}
+		record := make([]string, len(names))
+		writeRow = func(values []interface{}) error {
+			for i, v := range values {
+				cell, err := encodeCSV(v, typeNames[i])
+				if err != nil {
+					return fmt.Errorf("column %s: %v", names[i], err)
+				}
+				record[i] = cell
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	case JSONL:
+		keys := make([][]byte, len(names))
+		for i, name := range names {
+			keys[i], _ = json.Marshal(name)
+		}
+		writeRow = func(values []interface{}) error {
+			// the object is written by hand, to keep the columns in order
+			var line []byte
+			for i, v := range values {
+				val, err := encodeJSON(v, typeNames[i])
+				if err != nil {
+					return fmt.Errorf("column %s: %v", names[i], err)
+				}
+				encoded, err := json.Marshal(val)
+				if err != nil {
+					return fmt.Errorf("column %s: %v", names[i], err)
+				}
+				if i == 0 {
+					line = append(line, '{')
+				} else {
+					line = append(line, ',')
+				}
+				line = append(line, keys[i]...)
+				line = append(line, ':')
+				line = append(line, encoded...)
+			}
+			if len(values) == 0 {
+				line = append(line, '{')
+			}
+			line = append(line, '}', '\n')
+			_, err := w.Write(line)
+			return err
+		}
+		flush = func() error { return nil }
+	default:
+		return 0, fmt.Errorf("unknown format %v", format)
+	}
+
+	var n int64
+	values := make([]interface{}, len(names))
+	dest := make([]interface{}, len(names))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return n, err
+		}
+		if err := writeRow(values); err != nil {
+			return n, fmt.Errorf("row %d: %v", n+1, err)
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+// quotes a table name for the driver and spanner, they both read backticks
+func quoteIdent(name string) string {
+	return "`" + strings.Replace(name, "`", "\\`", -1) + "`"
+}
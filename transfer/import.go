@@ -0,0 +1,466 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+)
+
+// ImportOptions changes how rows are written by Import
+type ImportOptions struct {
+	// replace rows that already exist, instead of failing their batch. Without it a
+	// batch whose commit timed out after writing its rows fails when it is retried
+	Upsert bool
+	// the limits of each commit, sqlspanner.DefaultBulkLoadMaxMutations and
+	// sqlspanner.DefaultBulkLoadMaxBytes when 0
+	MaxMutations int
+	MaxBytes     int
+}
+
+// Import writes the rows read from r to table, and returns the number of rows read.
+// The columns are named by the CSV header, or the keys of the first JSONL object,
+// and values are converted to the types of the table's columns. Generated columns,
+// which exports of SELECT * include, are skipped. Rows are committed
+// in batches with a sqlspanner.BulkLoader, so an import is not atomic: when some
+// batches fail a *sqlspanner.BulkLoadError lists them
+func Import(ctx context.Context, conn *sql.Conn, r io.Reader, format Format, table string, opts *ImportOptions) (int64, error) {
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	types, err := columnTypes(ctx, conn, table)
+	if err != nil {
+		return 0, err
+	}
+
+	var read func() ([]interface{}, error)
+	var columns []string
+	switch format {
+	case CSV:
+		read, columns, err = csvRows(r, types)
+	case JSONL:
+		read, columns, err = jsonlRows(r, types)
+	default:
+		return 0, fmt.Errorf("unknown format %v", format)
+	}
+	if err == io.EOF {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	loader, err := sqlspanner.NewBulkLoader(conn, table, columns)
+	if err != nil {
+		return 0, err
+	}
+	if !opts.Upsert {
+		loader.Op = spanner.Insert
+	}
+	if opts.MaxMutations > 0 {
+		loader.MaxMutations = opts.MaxMutations
+	}
+	if opts.MaxBytes > 0 {
+		loader.MaxBytes = opts.MaxBytes
+	}
+
+	var n int64
+	for {
+		values, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = loader.Add(ctx, values...)
+		}
+		if err != nil {
+			// wait for the batches already committing, their errors are less important
+			loader.Flush(ctx)
+			return n, fmt.Errorf("row %d: %v", n+1, err)
+		}
+		n++
+	}
+	return n, loader.Flush(ctx)
+}
+
+// looks up the types of a table's columns, by lower case name
+func columnTypes(ctx context.Context, conn *sql.Conn, table string) (map[string]column, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s LIMIT 0", quoteIdent(table)))
+	if err != nil {
+		return nil, fmt.Errorf("looking up the columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	// the conn runs one query at a time
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	generated, err := generatedColumns(ctx, conn, table)
+	if err != nil {
+		return nil, fmt.Errorf("looking up the generated columns of %s: %v", table, err)
+	}
+	types := make(map[string]column, len(cts))
+	for _, ct := range cts {
+		key := strings.ToLower(ct.Name())
+		types[key] = column{name: ct.Name(), typ: ct.DatabaseTypeName(), generated: generated[key]}
+	}
+	return types, nil
+}
+
+// looks up the generated columns of a table, by lower case name. Databases
+// without an information schema, like the fake, have none
+var generatedColumns = func(ctx context.Context, conn *sql.Conn, table string) (map[string]bool, error) {
+	hasSchema, err := sqlspanner.HasInformationSchema(conn)
+	if err != nil || !hasSchema {
+		return nil, err
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS
+		WHERE TABLE_SCHEMA = '' AND TABLE_NAME = ? AND IS_GENERATED = 'ALWAYS'`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	generated := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		generated[strings.ToLower(name)] = true
+	}
+	return generated, rows.Err()
+}
+
+type column struct {
+	name string
+	typ  string
+	// spanner computes the column's values, they are not written
+	generated bool
+}
+
+// matches the columns named by a file to the table's columns
+func tableColumns(table map[string]column, names []string) ([]column, error) {
+	cols := make([]column, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		key := strings.ToLower(name)
+		col, ok := table[key]
+		if !ok {
+			return nil, fmt.Errorf("the table has no column %s", name)
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("column %s is named twice", name)
+		}
+		seen[key] = true
+		cols[i] = col
+	}
+	return cols, nil
+}
+
+// the names of the columns that are written
+func names(cols []column) []string {
+	out := make([]string, 0, len(cols))
+	for _, c := range cols {
+		if !c.generated {
+			out = append(out, c.name)
+		}
+	}
+	return out
+}
+
+func csvRows(r io.Reader, table map[string]column) (func() ([]interface{}, error), []string, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+	cols, err := tableColumns(table, header)
+	if err != nil {
+		return nil, nil, err
+	}
+	cr.ReuseRecord = true
+	return func() ([]interface{}, error) {
+		record, err := cr.Read()
+		if err != nil {
+			return nil, err
+		}
+		values := make([]interface{}, 0, len(cols))
+		for i, field := range record {
+			if cols[i].generated {
+				continue
+			}
+			var v interface{}
+			if field == CSVNull {
+				v, err = nullOf(cols[i].typ)
+			} else if isJSONType(cols[i].typ) {
+				v, err = fromJSON(json.RawMessage(field), cols[i].typ)
+			} else {
+				v, err = fromString(field, cols[i].typ)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %v", cols[i].name, err)
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}, names(cols), nil
+}
+
+func jsonlRows(r io.Reader, table map[string]column) (func() ([]interface{}, error), []string, error) {
+	dec := json.NewDecoder(r)
+	keys, raws, err := readObject(dec)
+	if err != nil {
+		return nil, nil, err
+	}
+	cols, err := tableColumns(table, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	positions := make(map[string]int, len(keys))
+	for i, key := range keys {
+		positions[key] = i
+	}
+	first := true
+	return func() ([]interface{}, error) {
+		if first {
+			first = false
+		} else {
+			var keys []string
+			var row []json.RawMessage
+			keys, row, err = readObject(dec)
+			if err != nil {
+				return nil, err
+			}
+			if len(keys) != len(cols) {
+				return nil, fmt.Errorf("expected the %d keys of the first row, got %d", len(cols), len(keys))
+			}
+			raws = make([]json.RawMessage, len(cols))
+			for i, key := range keys {
+				pos, ok := positions[key]
+				if !ok || raws[pos] != nil {
+					return nil, fmt.Errorf("unexpected key %q", key)
+				}
+				raws[pos] = row[i]
+			}
+		}
+		values := make([]interface{}, 0, len(cols))
+		for i, raw := range raws {
+			if cols[i].generated {
+				continue
+			}
+			v, err := fromJSON(raw, cols[i].typ)
+			if err != nil {
+				return nil, fmt.Errorf("column %s: %v", cols[i].name, err)
+			}
+			values = append(values, v)
+		}
+		return values, nil
+	}, names(cols), nil
+}
+
+// reads the next object from dec, keeping the order of its keys
+func readObject(dec *json.Decoder) ([]string, []json.RawMessage, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, nil, fmt.Errorf("expected a json object, got %v", tok)
+	}
+	var keys []string
+	var values []json.RawMessage
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, tok.(string))
+		values = append(values, raw)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, nil, err
+	}
+	return keys, values, nil
+}
+
+// JSON, ARRAY and STRUCT fields of a CSV file hold json text
+func isJSONType(typ string) bool {
+	return typ == "JSON" || strings.HasPrefix(typ, "ARRAY<") || strings.HasPrefix(typ, "STRUCT<")
+}
+
+// returns the typed NULL of a column type, so spanner knows the type of the value
+func nullOf(typ string) (interface{}, error) {
+	if elem, ok := arrayElem(typ); ok {
+		null, err := nullOf(elem)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.Zero(reflect.SliceOf(reflect.TypeOf(null))).Interface(), nil
+	}
+	switch typ {
+	case "BOOL":
+		return spanner.NullBool{}, nil
+	case "INT64":
+		return spanner.NullInt64{}, nil
+	case "FLOAT64":
+		return spanner.NullFloat64{}, nil
+	case "NUMERIC":
+		return spanner.NullNumeric{}, nil
+	case "STRING":
+		return spanner.NullString{}, nil
+	case "BYTES":
+		return []byte(nil), nil
+	case "DATE":
+		return spanner.NullDate{}, nil
+	case "TIMESTAMP":
+		return spanner.NullTime{}, nil
+	case "JSON":
+		return spanner.NullJSON{}, nil
+	}
+	return nil, fmt.Errorf("cannot import %s columns", typ)
+}
+
+// converts a json value into a value for a column of type typ. Scalars can be
+// json strings, as they are exported, or json numbers and bools
+func fromJSON(raw json.RawMessage, typ string) (interface{}, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("expected a json value")
+	}
+	if string(raw) == "null" {
+		return nullOf(typ)
+	}
+	if typ == "JSON" {
+		if !json.Valid(raw) {
+			return nil, fmt.Errorf("invalid json %q", raw)
+		}
+		return spanner.NullJSON{Value: append(json.RawMessage(nil), raw...), Valid: true}, nil
+	}
+	if elem, ok := arrayElem(typ); ok {
+		var elems []json.RawMessage
+		if err := json.Unmarshal(raw, &elems); err != nil {
+			return nil, fmt.Errorf("expected a json array for %s: %v", typ, err)
+		}
+		null, err := nullOf(elem)
+		if err != nil {
+			return nil, err
+		}
+		vals := reflect.MakeSlice(reflect.SliceOf(reflect.TypeOf(null)), len(elems), len(elems))
+		for i, e := range elems {
+			v, err := fromJSON(e, elem)
+			if err != nil {
+				return nil, fmt.Errorf("element %d: %v", i, err)
+			}
+			vals.Index(i).Set(reflect.ValueOf(v))
+		}
+		return vals.Interface(), nil
+	}
+	switch raw[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return fromString(s, typ)
+	case 't', 'f':
+		if typ == "BOOL" {
+			return fromString(string(raw), typ)
+		}
+	case '[', '{':
+	default:
+		switch typ {
+		case "INT64", "FLOAT64", "NUMERIC":
+			return fromString(string(raw), typ)
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %s to %s", raw, typ)
+}
+
+// converts the text of a scalar into a value for a column of type typ
+func fromString(s string, typ string) (interface{}, error) {
+	switch typ {
+	case "BOOL":
+		b, err := strconv.ParseBool(s)
+		return spanner.NullBool{Bool: b, Valid: true}, err
+	case "INT64":
+		i, err := strconv.ParseInt(s, 10, 64)
+		return spanner.NullInt64{Int64: i, Valid: true}, err
+	case "FLOAT64":
+		// ParseFloat reads NaN, Infinity and -Infinity too
+		f, err := strconv.ParseFloat(s, 64)
+		return spanner.NullFloat64{Float64: f, Valid: true}, err
+	case "NUMERIC":
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid NUMERIC %q", s)
+		}
+		return spanner.NullNumeric{Numeric: *r, Valid: true}, nil
+	case "STRING":
+		return spanner.NullString{StringVal: s, Valid: true}, nil
+	case "BYTES":
+		b, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 BYTES: %v", err)
+		}
+		return b, nil
+	case "DATE":
+		d, err := civil.ParseDate(s)
+		return spanner.NullDate{Date: d, Valid: true}, err
+	case "TIMESTAMP":
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return spanner.NullTime{Time: t, Valid: true}, err
+	case "JSON":
+		return fromJSON(json.RawMessage(s), typ)
+	}
+	return nil, fmt.Errorf("cannot import %s columns", typ)
+}
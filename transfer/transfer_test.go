@@ -0,0 +1,283 @@
+//
+// Copyright 2017, TCN Inc.
+// All rights reserved.
+//
+// Redistribution and use in source and binary forms, with or without
+// modification, are permitted provided that the following conditions are
+// met:
+//
+//     * Redistributions of source code must retain the above copyright
+// notice, this list of conditions and the following disclaimer.
+//     * Redistributions in binary form must reproduce the above
+// copyright notice, this list of conditions and the following disclaimer
+// in the documentation and/or other materials provided with the
+// distribution.
+//     * Neither the name of TCN Inc. nor the names of its
+// contributors may be used to endorse or promote products derived from
+// this software without specific prior written permission.
+//
+// THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+// "AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+// LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+// A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+// OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+// SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+// LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+// DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+// THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+// (INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+// OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+
+package transfer_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/civil"
+	"cloud.google.com/go/spanner"
+	"github.com/tcncloud/sqlspanner"
+	"github.com/tcncloud/sqlspanner/fake"
+	"github.com/tcncloud/sqlspanner/transfer"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Formats", func() {
+	It("parses format names, and file extensions", func() {
+		f, err := transfer.ParseFormat("JSONL")
+		Expect(err).To(BeNil())
+		Expect(f).To(Equal(transfer.JSONL))
+		_, err = transfer.ParseFormat("xml")
+		Expect(err).ToNot(BeNil())
+		Expect(transfer.FormatOf("out/users.ndjson")).To(Equal(transfer.JSONL))
+		Expect(transfer.FormatOf("users.csv")).To(Equal(transfer.CSV))
+	})
+})
+
+var _ = Describe("Encoding", func() {
+	It("keeps the precision of NUMERIC values", func() {
+		r, _ := new(big.Rat).SetString("12345678901234567890.123456789")
+		v, err := transfer.EncodeJSON(r, "NUMERIC")
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal("12345678901234567890.123456789"))
+		v, err = transfer.FromJSON(json.RawMessage(`"12345678901234567890.123456789"`), "NUMERIC")
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(spanner.NullNumeric{Numeric: *r, Valid: true}))
+		v, err = transfer.FromJSON(json.RawMessage(`1.5`), "NUMERIC")
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(spanner.NullNumeric{Numeric: *big.NewRat(3, 2), Valid: true}))
+	})
+
+	It("writes JSON values as json", func() {
+		v, err := transfer.EncodeJSON(spanner.NullJSON{Value: map[string]interface{}{"a": 1}, Valid: true}, "JSON")
+		Expect(err).To(BeNil())
+		b, err := json.Marshal(v)
+		Expect(err).To(BeNil())
+		Expect(string(b)).To(Equal(`{"a":1}`))
+		cell, err := transfer.EncodeCSV(spanner.NullJSON{Value: []interface{}{"x"}, Valid: true}, "JSON")
+		Expect(err).To(BeNil())
+		Expect(cell).To(Equal(`["x"]`))
+
+		v, err = transfer.FromJSON(json.RawMessage(`{"a": [1, null]}`), "JSON")
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal(spanner.NullJSON{Value: json.RawMessage(`{"a": [1, null]}`), Valid: true}))
+		v, err = transfer.FromJSON(json.RawMessage(`null`), "ARRAY<JSON>")
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal([]spanner.NullJSON(nil)))
+		_, err = transfer.FromString(`{"a":`, "JSON")
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("writes floats that json has no numbers for as strings", func() {
+		for f, s := range map[float64]string{math.Inf(1): "Infinity", math.Inf(-1): "-Infinity"} {
+			v, err := transfer.EncodeJSON(f, "FLOAT64")
+			Expect(err).To(BeNil())
+			Expect(v).To(Equal(s))
+			v, err = transfer.FromString(s, "FLOAT64")
+			Expect(err).To(BeNil())
+			Expect(v).To(Equal(spanner.NullFloat64{Float64: f, Valid: true}))
+		}
+		v, err := transfer.EncodeJSON(spanner.NullFloat64{Float64: math.NaN(), Valid: true}, "FLOAT64")
+		Expect(err).To(BeNil())
+		Expect(v).To(Equal("NaN"))
+	})
+
+	It("writes structs as arrays of their fields", func() {
+		cell, err := transfer.EncodeCSV([]interface{}{int64(1), []byte("hi"), nil}, "STRUCT<a INT64, b BYTES, ARRAY<DATE>>")
+		Expect(err).To(BeNil())
+		Expect(cell).To(Equal(`[1,"aGk=",null]`))
+	})
+
+	It("rejects values of the wrong type", func() {
+		_, err := transfer.FromJSON(json.RawMessage(`true`), "INT64")
+		Expect(err).ToNot(BeNil())
+		_, err = transfer.FromJSON(json.RawMessage(`[1, "x"]`), "ARRAY<INT64>")
+		Expect(err).To(MatchError(ContainSubstring("element 1")))
+		_, err = transfer.FromString("not base64!", "BYTES")
+		Expect(err).ToNot(BeNil())
+	})
+})
+
+var _ = Describe("Transfer", func() {
+	var (
+		ctx    context.Context
+		fakeDB *fake.Database
+		db     *sql.DB
+		conn   *sql.Conn
+	)
+
+	const ddl = `CREATE TABLE things (
+		id INT64 NOT NULL,
+		f FLOAT64,
+		ok BOOL,
+		name STRING(MAX),
+		data BYTES(MAX),
+		day DATE,
+		at TIMESTAMP,
+		tags ARRAY<STRING(MAX)>,
+		nums ARRAY<INT64>,
+	) PRIMARY KEY (id)`
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		var err error
+		fakeDB, db, err = fake.Open("transfer_test", ddl, strings.Replace(ddl, "things", "copies", 1))
+		Expect(err).To(BeNil())
+		conn, err = db.Conn(ctx)
+		Expect(err).To(BeNil())
+
+		at := time.Date(2024, 3, 1, 12, 30, 0, 500, time.UTC)
+		cols := []string{"id", "f", "ok", "name", "data", "day", "at", "tags", "nums"}
+		Expect(sqlspanner.WriteMutations(ctx, conn,
+			spanner.Insert("things", cols, []interface{}{
+				int64(1), 1.5, true, "a,\"b\"", []byte("hi"), civil.Date{Year: 2024, Month: 3, Day: 1}, at,
+				[]spanner.NullString{{StringVal: "x", Valid: true}, {}}, []spanner.NullInt64{{Int64: 7, Valid: true}},
+			}),
+			spanner.Insert("things", cols, []interface{}{
+				int64(2), nil, nil, "", []byte{}, nil, nil, nil, []spanner.NullInt64{},
+			}),
+		)).To(BeNil())
+	})
+
+	AfterEach(func() {
+		Expect(conn.Close()).To(BeNil())
+		Expect(fakeDB.Close()).To(BeNil())
+	})
+
+	It("exports CSV", func() {
+		var buf bytes.Buffer
+		n, err := transfer.Export(ctx, db, &buf, transfer.CSV, "SELECT * FROM things ORDER BY id")
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(int64(2)))
+		Expect(buf.String()).To(Equal(
+			"id,f,ok,name,data,day,at,tags,nums\n" +
+				`1,1.5,true,"a,""b""",aGk=,2024-03-01,2024-03-01T12:30:00.0000005Z,"[""x"",null]",[7]` + "\n" +
+				`2,\N,\N,,,\N,\N,\N,[]` + "\n"))
+	})
+
+	It("exports JSONL", func() {
+		var buf bytes.Buffer
+		n, err := transfer.Export(ctx, db, &buf, transfer.JSONL, "SELECT id, data, tags FROM things WHERE id = ?", 1)
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(int64(1)))
+		Expect(buf.String()).To(Equal(`{"id":1,"data":"aGk=","tags":["x",null]}` + "\n"))
+	})
+
+	for _, format := range []transfer.Format{transfer.CSV, transfer.JSONL} {
+		format := format
+		It("imports what it exports, as "+format.String(), func() {
+			var buf bytes.Buffer
+			_, err := transfer.ExportTable(ctx, db, &buf, format, "things")
+			Expect(err).To(BeNil())
+			n, err := transfer.Import(ctx, conn, &buf, format, "copies", nil)
+			Expect(err).To(BeNil())
+			Expect(n).To(Equal(int64(2)))
+
+			var original, copied bytes.Buffer
+			_, err = transfer.Export(ctx, db, &original, transfer.JSONL, "SELECT * FROM things ORDER BY id")
+			Expect(err).To(BeNil())
+			_, err = transfer.Export(ctx, db, &copied, transfer.JSONL, "SELECT * FROM copies ORDER BY id")
+			Expect(err).To(BeNil())
+			Expect(copied.String()).To(Equal(original.String()))
+		})
+	}
+
+	for _, format := range []transfer.Format{transfer.CSV, transfer.JSONL} {
+		format := format
+		It("skips generated columns when importing what it exports, as "+format.String(), func() {
+			const ddl = "CREATE TABLE people (id INT64 NOT NULL, name STRING(MAX), doubled INT64 AS (id * 2) STORED) PRIMARY KEY (id)"
+			Expect(fakeDB.UpdateDDL(ddl)).To(BeNil())
+			Expect(fakeDB.UpdateDDL(strings.Replace(ddl, "people", "people_copies", 1))).To(BeNil())
+			Expect(sqlspanner.WriteMutations(ctx, conn,
+				spanner.Insert("people", []string{"id", "name"}, []interface{}{int64(1), "a"}),
+				spanner.Insert("people", []string{"id", "name"}, []interface{}{int64(2), nil}),
+			)).To(BeNil())
+			defer transfer.SetGeneratedColumns("doubled")()
+
+			var buf bytes.Buffer
+			_, err := transfer.ExportTable(ctx, db, &buf, format, "people")
+			Expect(err).To(BeNil())
+			Expect(buf.String()).To(ContainSubstring("doubled"))
+			n, err := transfer.Import(ctx, conn, &buf, format, "people_copies", nil)
+			Expect(err).To(BeNil())
+			Expect(n).To(Equal(int64(2)))
+
+			var copied bytes.Buffer
+			_, err = transfer.Export(ctx, db, &copied, transfer.JSONL, "SELECT * FROM people_copies ORDER BY id")
+			Expect(err).To(BeNil())
+			Expect(copied.String()).To(Equal(`{"id":1,"name":"a","doubled":2}` + "\n" + `{"id":2,"name":null,"doubled":4}` + "\n"))
+		})
+	}
+
+	It("imports JSONL with keys in any order, and values as json numbers and bools", func() {
+		in := `{"name": "a", "id": 3, "ok": false}` + "\n" + `{"ok": null, "id": "4", "name": null}`
+		n, err := transfer.Import(ctx, conn, strings.NewReader(in), transfer.JSONL, "copies", nil)
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(int64(2)))
+		var out bytes.Buffer
+		_, err = transfer.Export(ctx, db, &out, transfer.JSONL, "SELECT id, name, ok FROM copies ORDER BY id")
+		Expect(err).To(BeNil())
+		Expect(out.String()).To(Equal(`{"id":3,"name":"a","ok":false}` + "\n" + `{"id":4,"name":null,"ok":null}` + "\n"))
+	})
+
+	It("rejects columns the table does not have", func() {
+		_, err := transfer.Import(ctx, conn, strings.NewReader("id,nope\n1,2\n"), transfer.CSV, "copies", nil)
+		Expect(err).To(MatchError(ContainSubstring("no column nope")))
+		_, err = transfer.Import(ctx, conn, strings.NewReader(`{"id": 1}`+"\n"+`{"id": 2, "name": "b"}`), transfer.JSONL, "copies", nil)
+		Expect(err).To(MatchError(ContainSubstring("row 2")))
+	})
+
+	It("replaces rows when upserting", func() {
+		in := "id,name\n1,b\n"
+		_, err := transfer.Import(ctx, conn, strings.NewReader(in), transfer.CSV, "things", nil)
+		Expect(err).ToNot(BeNil())
+		_, err = transfer.Import(ctx, conn, strings.NewReader(in), transfer.CSV, "things", &transfer.ImportOptions{Upsert: true})
+		Expect(err).To(BeNil())
+		var name string
+		Expect(db.QueryRowContext(ctx, "SELECT name FROM things WHERE id = 1").Scan(&name)).To(BeNil())
+		Expect(name).To(Equal("b"))
+	})
+
+	It("commits large imports in batches", func() {
+		var in strings.Builder
+		in.WriteString("id\n")
+		for i := 10; i < 60; i++ {
+			in.WriteString(strconv.Itoa(i) + "\n")
+		}
+		n, err := transfer.Import(ctx, conn, strings.NewReader(in.String()), transfer.CSV, "copies", &transfer.ImportOptions{MaxMutations: 7})
+		Expect(err).To(BeNil())
+		Expect(n).To(Equal(int64(50)))
+		var count int64
+		Expect(db.QueryRowContext(ctx, "SELECT COUNT(*) FROM copies").Scan(&count)).To(BeNil())
+		Expect(count).To(Equal(int64(50)))
+	})
+})
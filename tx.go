@@ -33,30 +33,58 @@ package sqlspanner
 import (
 	"context"
 	"database/sql/driver"
-	"errors"
+	"fmt"
+
+	"cloud.google.com/go/spanner"
 )
 
+// a read write transaction. Writes made while it is open are buffered as
+// mutations, and applied together when it commits
 type tx struct {
-	opts *driver.TxOptions
-	c    *conn
-	ctx  context.Context
+	opts      *driver.TxOptions
+	c         *conn
+	ctx       context.Context
+	mutations []*spanner.Mutation
 }
 
 func newTransaction(ctx context.Context, c *conn, opts *driver.TxOptions) (driver.Tx, error) {
+	if c.tx != nil {
+		return nil, fmt.Errorf("a transaction is already running on this connection")
+	}
+	if c.batch != nil {
+		return nil, fmt.Errorf("cannot begin a transaction while a batch is running")
+	}
 	t := &tx{
 		opts: opts,
 		c:    c,
 		ctx:  ctx,
 	}
+	c.tx = t
 	return t, nil
 }
 
-// there is no Commit  in spanner, so this should just release its resources
+// applies the buffered mutations atomically
 func (t *tx) Commit() error {
-	// t = nil
+	t.c.tx = nil
+	t.c.commitTimestamp = nil
+	if len(t.mutations) == 0 {
+		return nil
+	}
+	commitTimestamp, err := t.c.client.Apply(t.ctx, t.mutations)
+	if err != nil {
+		// database/sql never retries a commit, the connection is only dropped
+		if isBadConn(err) {
+			t.c.bad = true
+		}
+		return spannerError(err)
+	}
+	t.c.commitTimestamp = &commitTimestamp
 	return nil
 }
 
+// discards the buffered mutations, nothing has been sent to spanner yet
 func (t *tx) Rollback() error {
-	return errors.New(UnsupportedError)
+	t.c.tx = nil
+	t.mutations = nil
+	return nil
 }
@@ -2,11 +2,18 @@ package sqlspanner
 
 import(
 	"encoding/gob"
+	"encoding/json"
 	"bytes"
 	"fmt"
 	"reflect"
 )
 
+// spanner.NullJSON stores its value in an interface{}, json values are always
+// normalized to a json.RawMessage before being encoded
+func init() {
+	gob.Register(json.RawMessage{})
+}
+
 // Stores type information found about a specific column for a statement
 // this type information is then used to help decode bytes into a value of the stored
 // type.  This approach should be safer than caching the actual argument, because multiple
@@ -34,8 +41,15 @@ func (t *typeCacheEncoder) encodeCol(i int, v interface{}) ([]byte, error) {
 		}
 	}
 	t.types[i] = typ
+	// encode non pointers through a pointer, so values like spanner.NullNumeric
+	// that hold a GobEncoder with a pointer receiver are addressable
+	enc := reflect.ValueOf(v)
+	if typ.Kind() != reflect.Ptr {
+		enc = reflect.New(typ)
+		enc.Elem().Set(reflect.ValueOf(v))
+	}
 	var buf bytes.Buffer
-	err := gob.NewEncoder(&buf).Encode(v)
+	err := gob.NewEncoder(&buf).EncodeValue(enc)
 	if err != nil {
 		return nil, err
 	}
@@ -32,18 +32,31 @@ package sqlspanner
 
 import (
 	"database/sql/driver"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"math/big"
+	"reflect"
 	"time"
 
 	"cloud.google.com/go/civil"
 	"cloud.google.com/go/spanner"
 	v1 "google.golang.org/genproto/googleapis/spanner/v1"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-type valueConverter struct{}
+type valueConverter struct {
+	mode ResultMode
+}
 
 func (v valueConverter) ConvertGenericCol(g *spanner.GenericColumnValue) (driver.Value, error) {
+	val, err := v.convertSpannerCol(g)
+	if err != nil || v.mode != ResultModeStandard {
+		return val, err
+	}
+	return StandardValue(val)
+}
+
+func (v valueConverter) convertSpannerCol(g *spanner.GenericColumnValue) (driver.Value, error) {
 	if g == nil {
 		return nil, nil
 	}
@@ -129,13 +142,32 @@ func (v valueConverter) ConvertGenericCol(g *spanner.GenericColumnValue) (driver
 		var val []byte
 		err := g.Decode(&val)
 		return val, err
+	case v1.TypeCode_NUMERIC:
+		var t big.Rat
+		var nt spanner.NullNumeric
+		err := g.Decode(&t)
+		if err != nil {
+			err = g.Decode(&nt)
+			if err != nil {
+				return nil, err
+			}
+			return nt, nil
+		}
+		return &t, nil
+	case v1.TypeCode_JSON: // json can hold any value, so it is always returned as a spanner.NullJSON
+		var nt spanner.NullJSON
+		err := g.Decode(&nt)
+		if err != nil {
+			return nil, err
+		}
+		return nt, nil
 	case v1.TypeCode_ARRAY: // [](basic type)  or []struct
 		if g.Type.ArrayElementType == nil {
 			return nil, fmt.Errorf("Recieved array TypeCode with nil ArrayElementType")
 		}
 		return convertArrayType(g, g.Type.ArrayElementType)
-	case v1.TypeCode_STRUCT: // unsupported
-		return nil, errors.New(UnimplementedError)
+	case v1.TypeCode_STRUCT: // structs are returned as a spanner.NullRow of their fields
+		return convertStructType(g)
 	default:
 	}
 	return nil, nil
@@ -174,11 +206,140 @@ func convertArrayType(g *spanner.GenericColumnValue, arrType *v1.Type) (driver.V
 		var val []spanner.NullDate
 		err := g.Decode(&val)
 		return val, err
-	case v1.TypeCode_STRUCT: //spanner.NullRow?
-		_ = g.Value.GetListValue().GetValues()[0].GetStructValue().GetFields()
-		// create []reflect.StructField from map["string"]*ptypes.Value
-		return nil, errors.New(UnimplementedError)
+	case v1.TypeCode_NUMERIC:
+		var val []spanner.NullNumeric
+		err := g.Decode(&val)
+		return val, err
+	case v1.TypeCode_JSON:
+		var val []spanner.NullJSON
+		err := g.Decode(&val)
+		return val, err
+	case v1.TypeCode_STRUCT: // read the fields of each row with Row.Column, or Row.ToStruct
+		var val []spanner.NullRow
+		err := g.Decode(&val)
+		return val, err
 	default:
 		return nil, fmt.Errorf("not able to decoded type")
 	}
 }
+
+// spanner encodes a struct as a list of its field values
+func convertStructType(g *spanner.GenericColumnValue) (driver.Value, error) {
+	if _, isNull := g.Value.GetKind().(*structpb.Value_NullValue); isNull {
+		return spanner.NullRow{}, nil
+	}
+	fields := g.Type.GetStructType().GetFields()
+	values := g.Value.GetListValue().GetValues()
+	if len(fields) != len(values) {
+		return nil, fmt.Errorf("struct has %d fields, but %d values", len(fields), len(values))
+	}
+	names := make([]string, len(fields))
+	cols := make([]interface{}, len(fields))
+	for i, f := range fields {
+		names[i] = f.Name
+		cols[i] = spanner.GenericColumnValue{Type: f.Type, Value: values[i]}
+	}
+	row, err := spanner.NewRow(names, cols)
+	if err != nil {
+		return nil, err
+	}
+	return spanner.NullRow{Row: *row, Valid: true}, nil
+}
+
+// StandardValue converts a value read in ResultModeSpanner into the one ResultModeStandard
+// returns for it. spanner.Null* values become nil, or the value they hold, and arrays become
+// a []interface{} of standard values. Standard values are returned as they are
+func StandardValue(v interface{}) (driver.Value, error) {
+	switch t := v.(type) {
+	case nil:
+		return nil, nil
+	case bool, int64, float64, string, time.Time:
+		return t, nil
+	case []byte:
+		if t == nil {
+			return nil, nil
+		}
+		return t, nil
+	case civil.Date:
+		return t.In(time.UTC), nil
+	case *big.Rat:
+		if t == nil {
+			return nil, nil
+		}
+		return spanner.NumericString(t), nil
+	case spanner.NullBool:
+		if !t.Valid {
+			return nil, nil
+		}
+		return t.Bool, nil
+	case spanner.NullInt64:
+		if !t.Valid {
+			return nil, nil
+		}
+		return t.Int64, nil
+	case spanner.NullFloat64:
+		if !t.Valid {
+			return nil, nil
+		}
+		return t.Float64, nil
+	case spanner.NullString:
+		if !t.Valid {
+			return nil, nil
+		}
+		return t.StringVal, nil
+	case spanner.NullTime:
+		if !t.Valid {
+			return nil, nil
+		}
+		return t.Time, nil
+	case spanner.NullDate:
+		if !t.Valid {
+			return nil, nil
+		}
+		return t.Date.In(time.UTC), nil
+	case spanner.NullNumeric:
+		if !t.Valid {
+			return nil, nil
+		}
+		return spanner.NumericString(&t.Numeric), nil
+	case spanner.NullJSON:
+		if !t.Valid {
+			return nil, nil
+		}
+		return json.Marshal(t.Value)
+	case spanner.NullRow:
+		// a struct becomes a []interface{} of its fields' standard values
+		if !t.Valid {
+			return nil, nil
+		}
+		vals := make([]interface{}, t.Row.Size())
+		for i := range vals {
+			var g spanner.GenericColumnValue
+			if err := t.Row.Column(i, &g); err != nil {
+				return nil, err
+			}
+			val, err := valueConverter{mode: ResultModeStandard}.ConvertGenericCol(&g)
+			if err != nil {
+				return nil, err
+			}
+			vals[i] = val
+		}
+		return vals, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("cannot convert %T to a standard driver.Value", v)
+	}
+	if rv.IsNil() {
+		return nil, nil
+	}
+	vals := make([]interface{}, rv.Len())
+	for i := range vals {
+		val, err := StandardValue(rv.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = val
+	}
+	return vals, nil
+}